@@ -1,26 +1,63 @@
 import type { lib } from '../../wailsjs/go/models'
 
-import { GenerateThumbnail } from '../../wailsjs/go/main/WApp'
+import { RequestThumbnails, PrioritizeThumbnails, CancelThumbnails } from '../../wailsjs/go/main/WApp'
+import { EventsOn } from '../../wailsjs/runtime/runtime'
 
 let thumbnailCache: {[key: string]: lib.Thumbnail} = {}
 
+let waiting: {[key: string]: ((thumbnail: lib.Thumbnail) => void)[]} = {}
+let batch: lib.ThumbnailRequest[] = []
+
+EventsOn('thumbnail', (data: any) => {
+  let thumbnail: lib.Thumbnail = data.Thumbnail
+  if (data.Error) {
+    thumbnail = {
+      Format: 'unknown',
+      Bytes: [],
+    }
+  }
+  thumbnailCache[data.ID] = thumbnail
+  for (let resolve of waiting[data.ID] || []) {
+    resolve(thumbnail)
+  }
+  delete waiting[data.ID]
+})
+
+// getThumbnail requests a thumbnail from the backend's thumbnail workers. Requests made together are sent as one batch.
 export async function getThumbnail(paths: string[], opts: lib.ThumbnailOptions): Promise<lib.Thumbnail> {
   let path = paths.join('/')
   if (thumbnailCache[path]) {
     return thumbnailCache[path]
   }
-  let thumbnail = await GenerateThumbnail(paths, opts)
-  if (thumbnail instanceof Error) {
-    let err = thumbnail
-    thumbnail = {
-      Format: 'unknown',
-      Bytes: [],
+  return new Promise(resolve => {
+    if (!waiting[path]) {
+      waiting[path] = []
+      if (!batch.length) {
+        setTimeout(() => {
+          RequestThumbnails(batch)
+          batch = []
+        }, 0)
+      }
+      batch.push({ ID: path, Path: path, Options: opts, Priority: 0 })
     }
-    thumbnailCache[path] = thumbnail
-    //throw err
-    return thumbnail
+    waiting[path].push(resolve)
+  })
+}
+
+// prioritizeThumbnail sets the priority of a pending thumbnail, such as when it scrolls into view.
+export function prioritizeThumbnail(paths: string[], priority: number) {
+  let path = paths.join('/')
+  if (waiting[path]) {
+    PrioritizeThumbnails([path], priority)
   }
+}
 
-  thumbnailCache[path] = thumbnail
-  return thumbnail
+// cancelThumbnail cancels a pending thumbnail, such as when it is no longer shown.
+export function cancelThumbnail(paths: string[]) {
+  let path = paths.join('/')
+  if (waiting[path]) {
+    delete waiting[path]
+    batch = batch.filter(r => r.ID !== path)
+    CancelThumbnails([path])
+  }
 }
@@ -33,6 +33,7 @@ export class DirectoryView {
 export class TagsView {
   uuid: number[] | string
   tags: string[]
+  query: string
   selected: string[]
   focused: string
   constructor(o: any) {
@@ -42,6 +43,11 @@ export class TagsView {
     if (o.tags) {
       this.tags = o.tags
     }
+    if (o.query) {
+      this.query = o.query
+    } else {
+      this.query = ''
+    }
     if (o.selected) {
       this.selected = o.selected
     } else {
@@ -25,6 +25,7 @@ export interface DirectoryStore extends Writable<DirectoryStoreData> {
   addEntry: (e: lib.DirectoryEntry) => void
   getByPath: (p: string) => DirectoryEntryStore
   removeByPath: (p: string) => void
+  moveEntry: (from: string, e: lib.DirectoryEntry) => void
 }
 
 function createDirectoryStore(d: lib.Directory): DirectoryStore {
@@ -50,6 +51,17 @@ function createDirectoryStore(d: lib.Directory): DirectoryStore {
       ftt.Remove(dir.Tree, p)
       set(dir)
     },
+    moveEntry: (from: string, e: lib.DirectoryEntry) => {
+      let dir = get({subscribe})
+      let entry = dir.Entries.find(v=>get(v).Path===from)
+      if (!entry) {
+        return
+      }
+      entry.set(e)
+      ftt.Remove(dir.Tree, from)
+      ftt.Insert(dir.Tree, e.Path, entry)
+      set(dir)
+    },
     addEntry: (e: lib.DirectoryEntry) => {
       let dir = get({subscribe})
       if (dir.Entries.find(v=>get(v).Path===e.Path)) {
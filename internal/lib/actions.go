@@ -1,7 +1,7 @@
 package lib
 
 import (
-	"fmt"
+	"log"
 	"treesource/internal/do"
 
 	"github.com/google/uuid"
@@ -15,30 +15,32 @@ type AddDirectoryAction struct {
 
 // Apply does the obvious.
 func (a *AddDirectoryAction) Apply(p *Project) {
-	fmt.Println("action: apply add dir")
+	log.Println("action: apply add dir")
 	if len(p.Directories) == a.Index {
 		p.Directories = append(p.Directories, *a.Directory.Clone())
 	} else {
 		p.Directories = append(p.Directories[:a.Index+1], p.Directories[a.Index:]...)
 		p.Directories[a.Index] = *a.Directory.Clone()
 	}
+	p.reindex()
 	p.Emit(EventDirectoryAdd, DirectoryAddEvent{
 		UUID:       a.Directory.UUID,
 		Path:       a.Directory.Path,
 		IgnoreDot:  a.Directory.IgnoreDot,
 		SyncOnLoad: a.Directory.SyncOnLoad,
+		Watch:      a.Directory.Watch,
 		Separator:  a.Directory.Separator,
 	})
 	// Need to rehook garbage.
-	p.InitDirectory(&p.Directories[a.Index])
-	// Seems reasonable enough to emit all entries on load.
-	p.Directories[a.Index].EmitAllEntries()
+	p.initDirectoryAfter(a.Directory.UUID)
 }
 
 // Unapply does the obvious.
 func (a *AddDirectoryAction) Unapply(p *Project) {
-	fmt.Println("action: unapply add dir")
+	log.Println("action: unapply add dir")
+	p.StopWatching(a.Directory.UUID)
 	p.Directories = append(p.Directories[:a.Index], p.Directories[a.Index+1:]...)
+	p.reindex()
 	p.Emit(EventDirectoryRemove, DirectoryRemoveEvent{
 		UUID: a.Directory.UUID,
 	})
@@ -52,10 +54,12 @@ type RemoveDirectoryAction struct {
 
 // Apply does the obvious.
 func (a *RemoveDirectoryAction) Apply(p *Project) {
-	fmt.Println("action: apply remove dir")
+	log.Println("action: apply remove dir")
+	p.StopWatching(a.Directory.UUID)
 	for i, d := range p.Directories {
 		if d.UUID.String() == a.Directory.UUID.String() {
 			p.Directories = append(p.Directories[:i], p.Directories[i+1:]...)
+			p.reindex()
 			p.Emit(EventDirectoryRemove, DirectoryRemoveEvent{
 				UUID: d.UUID,
 			})
@@ -66,24 +70,24 @@ func (a *RemoveDirectoryAction) Apply(p *Project) {
 
 // Unapply does the obvious.
 func (a *RemoveDirectoryAction) Unapply(p *Project) {
-	fmt.Println("action: unapply remove dir")
+	log.Println("action: unapply remove dir")
 	if len(p.Directories) == a.Index {
 		p.Directories = append(p.Directories, *a.Directory.Clone())
 	} else {
 		p.Directories = append(p.Directories[:a.Index+1], p.Directories[a.Index:]...)
 		p.Directories[a.Index] = *a.Directory.Clone()
 	}
+	p.reindex()
 	p.Emit(EventDirectoryAdd, DirectoryAddEvent{
 		UUID:       a.Directory.UUID,
 		Path:       a.Directory.Path,
 		IgnoreDot:  a.Directory.IgnoreDot,
 		SyncOnLoad: a.Directory.SyncOnLoad,
+		Watch:      a.Directory.Watch,
 		Separator:  a.Directory.Separator,
 	})
 	// Need to rehook garbage.
-	p.InitDirectory(&p.Directories[a.Index])
-	// Seems reasonable enough to emit all entries on load.
-	p.Directories[a.Index].EmitAllEntries()
+	p.initDirectoryAfter(a.Directory.UUID)
 }
 
 type SyncDirectoryAction struct {
@@ -91,11 +95,217 @@ type SyncDirectoryAction struct {
 }
 
 func (a *SyncDirectoryAction) Apply(p *Project) {
-	fmt.Println("action: apply sync dir")
+	log.Println("action: apply sync dir")
 }
 
 func (a *SyncDirectoryAction) Unapply(p *Project) {
-	fmt.Println("action: unapply sync dir")
+	log.Println("action: unapply sync dir")
+}
+
+// SetDirectoryWatchAction enables or disables watching a directory.
+type SetDirectoryWatchAction struct {
+	UUID  uuid.UUID
+	Watch bool
+}
+
+func (a *SetDirectoryWatchAction) Apply(p *Project) {
+	a.set(p, a.Watch)
+}
+
+func (a *SetDirectoryWatchAction) Unapply(p *Project) {
+	a.set(p, !a.Watch)
+}
+
+func (a *SetDirectoryWatchAction) set(p *Project, watch bool) {
+	for i := range p.Directories {
+		d := &p.Directories[i]
+		if d.UUID != a.UUID {
+			continue
+		}
+		d.Watch = watch
+		if watch {
+			if err := p.StartWatching(d); err != nil {
+				p.Emit(EventDirectoryWatch, DirectoryWatchEvent{
+					UUID:  d.UUID,
+					Error: err,
+				})
+			}
+		} else {
+			p.StopWatching(d.UUID)
+		}
+		return
+	}
+}
+
+// SetDirectoryFollowLinksAction sets if a directory follows symlinked directories. A running watcher of the directory is restarted so that it watches them too.
+type SetDirectoryFollowLinksAction struct {
+	UUID        uuid.UUID
+	FollowLinks bool
+}
+
+func (a *SetDirectoryFollowLinksAction) Apply(p *Project) {
+	a.set(p, a.FollowLinks)
+}
+
+func (a *SetDirectoryFollowLinksAction) Unapply(p *Project) {
+	a.set(p, !a.FollowLinks)
+}
+
+func (a *SetDirectoryFollowLinksAction) set(p *Project, follow bool) {
+	for i := range p.Directories {
+		if d := &p.Directories[i]; d.UUID == a.UUID {
+			d.FollowLinks = follow
+			p.rewatch(d)
+		}
+	}
+}
+
+// SetDirectoryRelativeAction sets if a directory's path is saved relative to the project file.
+type SetDirectoryRelativeAction struct {
+	UUID     uuid.UUID
+	Relative bool
+}
+
+func (a *SetDirectoryRelativeAction) Apply(p *Project) {
+	a.set(p, a.Relative)
+}
+
+func (a *SetDirectoryRelativeAction) Unapply(p *Project) {
+	a.set(p, !a.Relative)
+}
+
+func (a *SetDirectoryRelativeAction) set(p *Project, relative bool) {
+	for i := range p.Directories {
+		if d := &p.Directories[i]; d.UUID == a.UUID {
+			d.Relative = relative
+		}
+	}
+}
+
+// RelocateDirectoryAction points a directory at a new root, keeping its entries. A running watcher of the directory is restarted at the new root.
+type RelocateDirectoryAction struct {
+	UUID     uuid.UUID
+	Path     string
+	previous string
+}
+
+func (a *RelocateDirectoryAction) Apply(p *Project) {
+	for i := range p.Directories {
+		if d := &p.Directories[i]; d.UUID == a.UUID {
+			a.previous = d.Path
+			a.relocate(p, d, a.Path)
+		}
+	}
+}
+
+func (a *RelocateDirectoryAction) Unapply(p *Project) {
+	for i := range p.Directories {
+		if d := &p.Directories[i]; d.UUID == a.UUID {
+			a.relocate(p, d, a.previous)
+		}
+	}
+}
+
+func (a *RelocateDirectoryAction) relocate(p *Project, d *Directory, path string) {
+	from := d.Path
+	d.Path = path
+	p.rewatch(d)
+	p.Emit(EventDirectoryRelocate, DirectoryRelocateEvent{
+		UUID: d.UUID,
+		From: from,
+		Path: path,
+	})
+}
+
+// SetDirectoryXMPSidecarsAction sets how a directory's entries are synced with their XMP sidecars.
+type SetDirectoryXMPSidecarsAction struct {
+	UUID     uuid.UUID
+	Mode     string
+	previous string
+}
+
+func (a *SetDirectoryXMPSidecarsAction) Apply(p *Project) {
+	for i := range p.Directories {
+		if d := &p.Directories[i]; d.UUID == a.UUID {
+			a.previous = d.XMPSidecars
+			d.XMPSidecars = a.Mode
+		}
+	}
+}
+
+func (a *SetDirectoryXMPSidecarsAction) Unapply(p *Project) {
+	for i := range p.Directories {
+		if d := &p.Directories[i]; d.UUID == a.UUID {
+			d.XMPSidecars = a.previous
+		}
+	}
+}
+
+// SetDirectoryIgnoreAction sets a directory's ignore patterns and removes the entries they leave out. A running watcher of the directory is restarted so that it uses them.
+type SetDirectoryIgnoreAction struct {
+	UUID     uuid.UUID
+	Patterns []string
+	previous []string
+	removed  []*RemoveEntryAction
+	ignores  *ignoreCache // ignores is the patterns' cache, if it was loaded beforehand.
+}
+
+func (a *SetDirectoryIgnoreAction) Apply(p *Project) {
+	for i := range p.Directories {
+		if d := &p.Directories[i]; d.UUID == a.UUID {
+			a.previous = d.Ignore
+			d.Ignore = a.Patterns
+			if a.ignores == nil {
+				a.ignores = newIgnoreCache(d.Path, a.Patterns)
+			}
+			a.removed = nil
+			for _, path := range d.ignoredEntries(a.ignores) {
+				r := &RemoveEntryAction{
+					UUID: a.UUID,
+					Path: path,
+				}
+				r.Apply(p)
+				a.removed = append(a.removed, r)
+			}
+			p.rewatch(d)
+		}
+	}
+}
+
+func (a *SetDirectoryIgnoreAction) Unapply(p *Project) {
+	for i := range p.Directories {
+		if d := &p.Directories[i]; d.UUID == a.UUID {
+			for j := len(a.removed) - 1; j >= 0; j-- {
+				a.removed[j].Unapply(p)
+			}
+			d.Ignore = a.previous
+			p.rewatch(d)
+		}
+	}
+}
+
+// SetDirectoryIncludeAction sets the filter of which files become a directory's entries.
+type SetDirectoryIncludeAction struct {
+	UUID     uuid.UUID
+	Include  *IncludeFilter
+	previous *IncludeFilter
+}
+
+func (a *SetDirectoryIncludeAction) Apply(p *Project) {
+	for i := range p.Directories {
+		if d := &p.Directories[i]; d.UUID == a.UUID {
+			a.previous = d.Include
+			d.Include = a.Include
+		}
+	}
+}
+
+func (a *SetDirectoryIncludeAction) Unapply(p *Project) {
+	for i := range p.Directories {
+		if d := &p.Directories[i]; d.UUID == a.UUID {
+			d.Include = a.previous
+		}
+	}
 }
 
 type UpdateEntryAction struct {
@@ -115,7 +325,7 @@ func (a *UpdateEntryAction) Apply(p *Project) {
 		return
 	}
 	a.previous = entry.Clone()
-	entry.Subsume(a.Entry)
+	dir.subsume(entry, a.Entry)
 	dir.Emit(EventDirectoryEntryUpdate, DirectoryEntryUpdateEvent{
 		UUID:  a.UUID,
 		Entry: entry,
@@ -131,7 +341,7 @@ func (a *UpdateEntryAction) Unapply(p *Project) {
 	if entry == nil {
 		return
 	}
-	entry.Subsume(a.previous)
+	dir.subsume(entry, a.previous)
 	dir.Emit(EventDirectoryEntryUpdate, DirectoryEntryUpdateEvent{
 		UUID:  a.UUID,
 		Entry: entry,
@@ -170,18 +380,34 @@ func (a *RemoveEntryAction) Unapply(p *Project) {
 	if a.previous == nil {
 		return
 	}
-	if len(dir.Entries) == a.index {
-		dir.Entries = append(dir.Entries, a.previous)
-	} else {
-		dir.Entries = append(dir.Entries[:a.index+1], dir.Entries[a.index:]...)
-		dir.Entries[a.index] = a.previous
-	}
+	dir.Insert(a.index, a.previous)
 	dir.Emit(EventDirectoryEntryAdd, DirectoryEntryAddEvent{
 		UUID:  a.UUID,
 		Entry: a.previous,
 	})
 }
 
+// SetTagRegistryAction replaces the project's tag registry.
+type SetTagRegistryAction struct {
+	Registry TagRegistry
+	previous TagRegistry
+}
+
+func (a *SetTagRegistryAction) Apply(p *Project) {
+	a.previous = p.TagRegistry.Clone()
+	p.TagRegistry = a.Registry.Clone()
+	p.Emit(EventTagRegistryUpdate, TagRegistryUpdateEvent{
+		Registry: p.TagRegistry,
+	})
+}
+
+func (a *SetTagRegistryAction) Unapply(p *Project) {
+	p.TagRegistry = a.previous.Clone()
+	p.Emit(EventTagRegistryUpdate, TagRegistryUpdateEvent{
+		Registry: p.TagRegistry,
+	})
+}
+
 // GroupedAction represents a collection of actions.
 type GroupedAction struct {
 	Actions []do.Action[*Project]
@@ -196,7 +422,7 @@ func (a *GroupedAction) Apply(p *Project) {
 
 // Unapply unapplies the contains actions from the end to the start.
 func (a *GroupedAction) Unapply(p *Project) {
-	for i := len(a.Actions); i > 0; i-- {
+	for i := len(a.Actions) - 1; i >= 0; i-- {
 		a.Actions[i].Unapply(p)
 	}
 }
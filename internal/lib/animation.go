@@ -0,0 +1,325 @@
+package lib
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+)
+
+// Animation formats.
+const (
+	AnimationGIF  = "gif"
+	AnimationAPNG = "apng"
+)
+
+// AnimationFrame refers to an image entry, or to one frame of its sprite sheet, to use as a frame of an animation.
+type AnimationFrame struct {
+	Directory uuid.UUID `json:"Directory"`
+	Path      string    `json:"Path"`
+	Frame     string    `json:"Frame"` // Frame is the name of a sprite sheet frame, `*` for all of the sheet's frames in order, or empty for the whole image.
+}
+
+// AnimationOptions configures how an animation is assembled.
+type AnimationOptions struct {
+	Format        string           `json:"Format"`        // should be gif or apng. Defaults to gif.
+	FrameDuration int              `json:"FrameDuration"` // FrameDuration is in milliseconds. Defaults to 100.
+	Loops         int              `json:"Loops"`         // Loops is the number of times to play the animation, or 0 to loop forever. Negative counts are refused.
+	Scale         ThumbnailOptions `json:"Scale"`         // Scale sizes each frame. A zero maximum size keeps frames at their original size.
+}
+
+// AnimationError is returned when an animation cannot be assembled.
+type AnimationError struct {
+	message string
+}
+
+func (e *AnimationError) Error() string {
+	return fmt.Sprintf("cannot create animation: %s", e.message)
+}
+
+// animationFrames decodes, slices, and scales the given frames.
+func (p *Project) animationFrames(refs []AnimationFrame, scale ThumbnailOptions) ([]image.Image, error) {
+	decoded := make(map[string]image.Image)
+	var frames []image.Image
+	for _, ref := range refs {
+		dir, e, err := p.entryCopy(ref.Directory, ref.Path)
+		if err != nil {
+			return nil, err
+		}
+		name := filepath.Join(dir, e.Path)
+		img, ok := decoded[name]
+		if !ok {
+			f, err := os.Open(name)
+			if err != nil {
+				return nil, err
+			}
+			img, _, err = image.Decode(f)
+			f.Close()
+			if err != nil {
+				return nil, err
+			}
+			decoded[name] = img
+		}
+
+		var images []image.Image
+		if ref.Frame == "" {
+			images = append(images, img)
+		} else {
+			if e.Sheet == nil {
+				return nil, &SpriteSheetError{fmt.Sprintf("'%s' has no sprite sheet", ref.Path)}
+			}
+			for _, f := range e.Sheet.SliceFrames(img) {
+				if ref.Frame == "*" || ref.Frame == f.Name {
+					images = append(images, f.Image)
+				}
+			}
+			if len(images) == 0 {
+				return nil, &SpriteSheetError{fmt.Sprintf("'%s' has no frame '%s'", ref.Path, ref.Frame)}
+			}
+		}
+
+		for _, img := range images {
+			if scale.MaxWidth > 0 && scale.MaxHeight > 0 {
+				img = ScaleImage(img, scale)
+			}
+			frames = append(frames, img)
+		}
+	}
+	if len(frames) == 0 {
+		return nil, &AnimationError{"no frames"}
+	}
+	return frames, nil
+}
+
+// RenderAnimation assembles the given frames into an animated GIF or APNG. Frames of differing sizes are placed at the top-left of a canvas that fits them all.
+func (p *Project) RenderAnimation(refs []AnimationFrame, opts AnimationOptions) (Thumbnail, error) {
+	if opts.FrameDuration <= 0 {
+		opts.FrameDuration = 100
+	}
+	if opts.Format == "" {
+		opts.Format = AnimationGIF
+	}
+	if opts.Format != AnimationGIF && opts.Format != AnimationAPNG {
+		return Thumbnail{}, &AnimationError{fmt.Sprintf("unknown format '%s'", opts.Format)}
+	}
+	if opts.Loops < 0 {
+		return Thumbnail{}, &AnimationError{fmt.Sprintf("invalid loop count %d", opts.Loops)}
+	}
+
+	frames, err := p.animationFrames(refs, opts.Scale)
+	if err != nil {
+		return Thumbnail{}, err
+	}
+
+	// Place every frame on a common canvas.
+	var canvas image.Rectangle
+	for _, f := range frames {
+		canvas = canvas.Union(image.Rect(0, 0, f.Bounds().Dx(), f.Bounds().Dy()))
+	}
+	padded := make([]*image.NRGBA, len(frames))
+	for i, f := range frames {
+		dst := image.NewNRGBA(canvas)
+		draw.Draw(dst, f.Bounds().Sub(f.Bounds().Min), f, f.Bounds().Min, draw.Src)
+		padded[i] = dst
+	}
+
+	var b bytes.Buffer
+	if opts.Format == AnimationAPNG {
+		err = encodeAPNG(&b, padded, opts)
+	} else {
+		err = encodeGIF(&b, padded, opts)
+	}
+	if err != nil {
+		return Thumbnail{}, err
+	}
+	return Thumbnail{
+		Bytes:  b.Bytes(),
+		Format: opts.Format,
+	}, nil
+}
+
+// ExportAnimation assembles the given frames into an animation and writes it to dest.
+func (p *Project) ExportAnimation(refs []AnimationFrame, opts AnimationOptions, dest string) error {
+	t, err := p.RenderAnimation(refs, opts)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dest, t.Bytes, 0644)
+}
+
+// GIF
+
+// encodeGIF encodes the frames as a GIF. If the frames share 255 or fewer colors they are kept exactly, otherwise they are dithered to a fixed palette, unless nearest neighbor scaling asks for hard edges.
+func encodeGIF(w io.Writer, frames []*image.NRGBA, opts AnimationOptions) error {
+	pal := exactPalette(frames, 255)
+	exact := pal != nil
+	if !exact {
+		pal = append(color.Palette{}, palette.Plan9[:255]...)
+	}
+	// The last color is reserved for transparency.
+	pal = append(pal, color.Transparent)
+
+	// GIF counts repeats rather than plays, with 0 repeating forever and -1 playing once.
+	var loops int
+	switch {
+	case opts.Loops == 0:
+		loops = 0
+	case opts.Loops == 1:
+		loops = -1
+	default:
+		loops = opts.Loops - 1
+	}
+	anim := &gif.GIF{
+		LoopCount: loops,
+	}
+	for _, f := range frames {
+		dst := image.NewPaletted(f.Bounds(), pal)
+		if exact || opts.Scale.Method == "NearestNeighbor" {
+			draw.Draw(dst, dst.Bounds(), f, f.Bounds().Min, draw.Src)
+		} else {
+			draw.FloydSteinberg.Draw(dst, dst.Bounds(), f, f.Bounds().Min)
+		}
+		// Anything mostly transparent becomes fully transparent, as GIF has no partial transparency.
+		for y := f.Bounds().Min.Y; y < f.Bounds().Max.Y; y++ {
+			for x := f.Bounds().Min.X; x < f.Bounds().Max.X; x++ {
+				if f.NRGBAAt(x, y).A < 128 {
+					dst.SetColorIndex(x, y, uint8(len(pal)-1))
+				}
+			}
+		}
+		anim.Image = append(anim.Image, dst)
+		anim.Delay = append(anim.Delay, (opts.FrameDuration+5)/10)
+		anim.Disposal = append(anim.Disposal, gif.DisposalBackground)
+	}
+	return gif.EncodeAll(w, anim)
+}
+
+// exactPalette returns the opaque colors used by the frames, or nil if there are more than max.
+func exactPalette(frames []*image.NRGBA, max int) color.Palette {
+	seen := make(map[color.NRGBA]bool)
+	var pal color.Palette
+	for _, f := range frames {
+		for i := 0; i+3 < len(f.Pix); i += 4 {
+			if f.Pix[i+3] < 128 {
+				continue
+			}
+			c := color.NRGBA{f.Pix[i], f.Pix[i+1], f.Pix[i+2], 255}
+			if seen[c] {
+				continue
+			}
+			if len(pal) == max {
+				return nil
+			}
+			seen[c] = true
+			pal = append(pal, c)
+		}
+	}
+	if pal == nil {
+		pal = color.Palette{color.Black}
+	}
+	return pal
+}
+
+// APNG
+
+// encodeAPNG encodes the frames as an animated PNG of 8-bit RGBA.
+func encodeAPNG(w io.Writer, frames []*image.NRGBA, opts AnimationOptions) error {
+	bounds := frames[0].Bounds()
+	width, height := uint32(bounds.Dx()), uint32(bounds.Dy())
+
+	if _, err := w.Write([]byte("\x89PNG\r\n\x1a\n")); err != nil {
+		return err
+	}
+	chunk := func(kind string, data []byte) error {
+		var b bytes.Buffer
+		binary.Write(&b, binary.BigEndian, uint32(len(data)))
+		b.WriteString(kind)
+		b.Write(data)
+		crc := crc32.NewIEEE()
+		crc.Write([]byte(kind))
+		crc.Write(data)
+		binary.Write(&b, binary.BigEndian, crc.Sum32())
+		_, err := w.Write(b.Bytes())
+		return err
+	}
+	be := func(values ...interface{}) []byte {
+		var b bytes.Buffer
+		for _, v := range values {
+			binary.Write(&b, binary.BigEndian, v)
+		}
+		return b.Bytes()
+	}
+
+	// 8-bit depth, RGBA color type, default compression, filtering, and no interlacing.
+	if err := chunk("IHDR", be(width, height, uint8(8), uint8(6), uint8(0), uint8(0), uint8(0))); err != nil {
+		return err
+	}
+	if err := chunk("acTL", be(uint32(len(frames)), uint32(opts.Loops))); err != nil {
+		return err
+	}
+
+	delay := opts.FrameDuration
+	if delay > 0xffff {
+		delay = 0xffff
+	}
+	var seq uint32
+	for i, f := range frames {
+		// Dispose to transparent before the next frame, and replace rather than blend.
+		fctl := be(seq, width, height, uint32(0), uint32(0), uint16(delay), uint16(1000), uint8(1), uint8(0))
+		seq++
+		if err := chunk("fcTL", fctl); err != nil {
+			return err
+		}
+		data, err := compressNRGBA(f)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			err = chunk("IDAT", data)
+		} else {
+			err = chunk("fdAT", append(be(seq), data...))
+			seq++
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return chunk("IEND", nil)
+}
+
+// compressNRGBA returns the zlib-compressed scanlines of the image, each using the Sub filter.
+func compressNRGBA(img *image.NRGBA) ([]byte, error) {
+	var b bytes.Buffer
+	z := zlib.NewWriter(&b)
+	bounds := img.Bounds()
+	row := make([]byte, 1+bounds.Dx()*4)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		pix := img.Pix[img.PixOffset(bounds.Min.X, y) : img.PixOffset(bounds.Min.X, y)+bounds.Dx()*4]
+		row[0] = 1
+		for i := range pix {
+			if i < 4 {
+				row[1+i] = pix[i]
+			} else {
+				row[1+i] = pix[i] - pix[i-4]
+			}
+		}
+		if _, err := z.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	if err := z.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
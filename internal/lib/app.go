@@ -11,6 +11,7 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 	"treesource/internal/do"
 
 	"github.com/google/uuid"
@@ -32,9 +33,20 @@ import (
 
 // App struct
 type App struct {
-	ctx     context.Context
-	Project *Project
-	Session *Session
+	ctx         context.Context
+	Project     *Project
+	Session     *Session
+	Thumbnailer *Thumbnailer
+	perceptual  *PerceptualIndex
+	thumbnails  *ThumbnailCache
+	syncing     *syncState
+}
+
+// syncState holds the context that syncs run under so that they may be canceled.
+type syncState struct {
+	mutex  sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 // NewApp creates a new App application struct
@@ -42,7 +54,19 @@ func NewApp() *App {
 	mime.AddExtensionType(".yaml", "text/yaml")
 	mime.AddExtensionType(".yml", "text/yaml")
 	mime.AddExtensionType(".md", "text/markdown")
-	return &App{}
+	mime.AddExtensionType(".wav", "audio/wav")
+	mime.AddExtensionType(".flac", "audio/flac")
+	mime.AddExtensionType(".ogg", "audio/ogg")
+	mime.AddExtensionType(".oga", "audio/ogg")
+	mime.AddExtensionType(".mp3", "audio/mpeg")
+	a := &App{
+		syncing: &syncState{},
+	}
+	if dir, err := GetThumbnailCacheDir(); err == nil {
+		a.thumbnails = NewThumbnailCache(dir, DefaultThumbnailCacheLimit)
+	}
+	a.Thumbnailer = NewThumbnailer(a.thumbnails)
+	return a
 }
 
 func (a *App) Context() context.Context {
@@ -135,6 +159,38 @@ func (a *App) RemoveProjectDirectory(uuid uuid.UUID) error {
 	return nil
 }
 
+// SetProjectDirectoryWatch enables or disables watching a directory for changes.
+func (a *App) SetProjectDirectoryWatch(uuid uuid.UUID, watch bool) error {
+	if a.Project == nil {
+		return &NoProjectError{}
+	}
+	return a.Project.SetDirectoryWatch(uuid, watch)
+}
+
+// SetProjectDirectoryFollowLinks sets if symlinked directories are synced as part of a directory.
+func (a *App) SetProjectDirectoryFollowLinks(uuid uuid.UUID, follow bool) error {
+	if a.Project == nil {
+		return &NoProjectError{}
+	}
+	return a.Project.SetDirectoryFollowLinks(uuid, follow)
+}
+
+// SetProjectDirectoryRelative sets if a directory's path is saved relative to the project file.
+func (a *App) SetProjectDirectoryRelative(uuid uuid.UUID, relative bool) error {
+	if a.Project == nil {
+		return &NoProjectError{}
+	}
+	return a.Project.SetDirectoryRelative(uuid, relative)
+}
+
+// RelocateProjectDirectory points a directory at a new root, keeping its entries.
+func (a *App) RelocateProjectDirectory(uuid uuid.UUID, path string) error {
+	if a.Project == nil {
+		return &NoProjectError{}
+	}
+	return a.Project.RelocateDirectory(uuid, path)
+}
+
 func (a *App) UpdateProjectDirectoryEntry(uuid uuid.UUID, path string, entry DirectoryEntry) error {
 	if a.Project == nil {
 		return &NoProjectError{}
@@ -145,13 +201,202 @@ func (a *App) UpdateProjectDirectoryEntry(uuid uuid.UUID, path string, entry Dir
 	return nil
 }
 
+// QueryEntries returns every entry in the project matching the given query expression.
+func (a *App) QueryEntries(query string) ([]QueryMatch, error) {
+	if a.Project == nil {
+		return nil, &NoProjectError{}
+	}
+	q, err := ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	return a.Project.Query(q), nil
+}
+
+// QueryTagsView returns every entry in the project matching the given tags view's query.
+func (a *App) QueryTagsView(u uuid.UUID) ([]QueryMatch, error) {
+	if a.Project == nil {
+		return nil, &NoProjectError{}
+	}
+	if a.Session == nil {
+		return nil, &MissingSessionError{}
+	}
+	t, err := a.Session.GetTagsView(u)
+	if err != nil {
+		return nil, err
+	}
+	q, err := t.Parse()
+	if err != nil {
+		return nil, err
+	}
+	return a.Project.Query(q), nil
+}
+
+// ExportQuery exports every entry matching the given query expression into dest.
+func (a *App) ExportQuery(query string, dest string, opts ExportOptions) ([]ExportItem, error) {
+	matches, err := a.QueryEntries(query)
+	if err != nil {
+		return nil, err
+	}
+	return a.Project.Export(matches, dest, opts)
+}
+
+// ExportTagsView exports every entry matching the given tags view's query into dest.
+func (a *App) ExportTagsView(u uuid.UUID, dest string, opts ExportOptions) ([]ExportItem, error) {
+	matches, err := a.QueryTagsView(u)
+	if err != nil {
+		return nil, err
+	}
+	return a.Project.Export(matches, dest, opts)
+}
+
+// CheckQuery parses the given query expression, returning the parse error if it is malformed.
+func (a *App) CheckQuery(query string) *QueryParseError {
+	if _, err := ParseQuery(query); err != nil {
+		if perr, ok := err.(*QueryParseError); ok {
+			return perr
+		}
+	}
+	return nil
+}
+
+// GetTagTree returns the hierarchy of tags used in the project.
+func (a *App) GetTagTree() (*TagNode, error) {
+	if a.Project == nil {
+		return nil, &NoProjectError{}
+	}
+	return a.Project.TagTree(), nil
+}
+
+// MoveProjectTag moves a tag and its children beneath a new parent.
+func (a *App) MoveProjectTag(tag string, parent string) error {
+	if a.Project == nil {
+		return &NoProjectError{}
+	}
+	return a.Project.MoveTag(tag, parent)
+}
+
+// SetProjectTagAlias declares alias as an alias of tag.
+func (a *App) SetProjectTagAlias(alias string, tag string) error {
+	if a.Project == nil {
+		return &NoProjectError{}
+	}
+	return a.Project.SetTagAlias(alias, tag)
+}
+
+// RemoveProjectTagAlias removes the given alias.
+func (a *App) RemoveProjectTagAlias(alias string) error {
+	if a.Project == nil {
+		return &NoProjectError{}
+	}
+	return a.Project.RemoveTagAlias(alias)
+}
+
+// AddProjectTagImplication declares that tag implies implied.
+func (a *App) AddProjectTagImplication(tag string, implied string) error {
+	if a.Project == nil {
+		return &NoProjectError{}
+	}
+	return a.Project.AddTagImplication(tag, implied)
+}
+
+// RemoveProjectTagImplication removes the implication of implied by tag.
+func (a *App) RemoveProjectTagImplication(tag string, implied string) error {
+	if a.Project == nil {
+		return &NoProjectError{}
+	}
+	return a.Project.RemoveTagImplication(tag, implied)
+}
+
+// FindDuplicates returns groups of byte-identical files across the project's directories.
+func (a *App) FindDuplicates() ([]DuplicateGroup, error) {
+	if a.Project == nil {
+		return nil, &NoProjectError{}
+	}
+	return a.Project.FindDuplicates(), nil
+}
+
+// MergeDuplicateTags merges the tags of the source entries onto the target entry.
+func (a *App) MergeDuplicateTags(target EntryRef, sources []EntryRef) error {
+	if a.Project == nil {
+		return &NoProjectError{}
+	}
+	return a.Project.MergeTags(target, sources)
+}
+
+// SetEntrySpriteSheet sets or, if sheet is nil, clears the sprite sheet definition of the given entry.
+func (a *App) SetEntrySpriteSheet(u uuid.UUID, path string, sheet *SpriteSheet) error {
+	if a.Project == nil {
+		return &NoProjectError{}
+	}
+	return a.Project.SetEntrySpriteSheet(u, path, sheet)
+}
+
+// GenerateFrameThumbnails returns a thumbnail of every frame of the given entry's sprite sheet.
+func (a *App) GenerateFrameThumbnails(u uuid.UUID, path string, opts ThumbnailOptions) ([]FrameThumbnail, error) {
+	if a.Project == nil {
+		return nil, &NoProjectError{}
+	}
+	return a.Project.FrameThumbnails(u, path, opts)
+}
+
+// ExportEntryFrames writes every frame of the given entry's sprite sheet to the destination directory as PNGs.
+func (a *App) ExportEntryFrames(u uuid.UUID, path string, dest string) ([]string, error) {
+	if a.Project == nil {
+		return nil, &NoProjectError{}
+	}
+	return a.Project.ExportFrames(u, path, dest)
+}
+
+// GenerateAnimation assembles the given frames into an animated GIF or APNG for previewing.
+func (a *App) GenerateAnimation(frames []AnimationFrame, opts AnimationOptions) (Thumbnail, error) {
+	if a.Project == nil {
+		return Thumbnail{}, &NoProjectError{}
+	}
+	return a.Project.RenderAnimation(frames, opts)
+}
+
+// ExportAnimation assembles the given frames into an animated GIF or APNG and writes it to dest.
+func (a *App) ExportAnimation(frames []AnimationFrame, opts AnimationOptions, dest string) error {
+	if a.Project == nil {
+		return &NoProjectError{}
+	}
+	return a.Project.ExportAnimation(frames, opts, dest)
+}
+
+// FindSimilarEntries returns the image entries that are visually similar to the given entry, ranked by Hamming distance.
+func (a *App) FindSimilarEntries(u uuid.UUID, path string, opts SimilarOptions) ([]SimilarMatch, error) {
+	if a.Project == nil {
+		return nil, &NoProjectError{}
+	}
+	if a.perceptual == nil {
+		p, err := GetPerceptualIndexPath()
+		if err != nil {
+			return nil, err
+		}
+		if a.perceptual, err = LoadPerceptualIndex(p); err != nil {
+			return nil, err
+		}
+	}
+	matches, err := a.Project.FindSimilar(a.perceptual, EntryRef{
+		Directory: u,
+		Path:      path,
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+	return matches, a.perceptual.Save()
+}
+
 // SaveProject saves the current project.
 func (a *App) SaveProject(force bool) error {
 	if a.Project == nil {
 		return &NoProjectError{}
 	}
 	if a.Unsaved() || force {
+		a.Project.RLock()
 		b, err := yaml.Marshal(a.Project)
+		a.Project.RUnlock()
 		if err != nil {
 			return err
 		}
@@ -159,12 +404,92 @@ func (a *App) SaveProject(force bool) error {
 		if err != nil {
 			return err
 		}
-		a.Project.history.SavedPos = a.Project.history.Pos
+		a.Project.markSaved()
 	}
 
 	return nil
 }
 
+// SetProjectDirectoryXMPSidecars sets how a directory's entries are synced with their XMP sidecars: read, write, both, or empty to not use sidecars.
+func (a *App) SetProjectDirectoryXMPSidecars(u uuid.UUID, mode string) error {
+	if a.Project == nil {
+		return &NoProjectError{}
+	}
+	return a.Project.SetDirectoryXMPSidecars(u, mode)
+}
+
+// SyncXMPSidecars syncs the tags and ratings of a directory's entries with their XMP sidecars, reporting any conflicts.
+func (a *App) SyncXMPSidecars(u uuid.UUID) (XMPSyncReport, error) {
+	if a.Project == nil {
+		return XMPSyncReport{}, &NoProjectError{}
+	}
+	return a.Project.SyncXMPSidecars(u)
+}
+
+// ResolveXMPConflict resolves a conflict between an entry and its XMP sidecar by keeping either the sidecar's or the entry's tags and rating.
+func (a *App) ResolveXMPConflict(u uuid.UUID, path string, useSidecar bool) error {
+	if a.Project == nil {
+		return &NoProjectError{}
+	}
+	return a.Project.ResolveXMPConflict(u, path, useSidecar)
+}
+
+// PreviewProjectDirectoryIgnore returns the paths of a directory's entries that the given ignore patterns would drop.
+func (a *App) PreviewProjectDirectoryIgnore(u uuid.UUID, patterns []string) ([]string, error) {
+	if a.Project == nil {
+		return nil, &NoProjectError{}
+	}
+	return a.Project.IgnoredEntries(u, patterns)
+}
+
+// SetProjectDirectoryIgnore sets a directory's ignore patterns, returning the paths of the entries that were dropped.
+func (a *App) SetProjectDirectoryIgnore(u uuid.UUID, patterns []string) ([]string, error) {
+	if a.Project == nil {
+		return nil, &NoProjectError{}
+	}
+	return a.Project.SetDirectoryIgnore(u, patterns)
+}
+
+// PreviewProjectDirectoryInclude returns the paths of a directory's entries that the given include filter would not match.
+func (a *App) PreviewProjectDirectoryInclude(u uuid.UUID, filter *IncludeFilter) ([]string, error) {
+	if a.Project == nil {
+		return nil, &NoProjectError{}
+	}
+	return a.Project.ExcludedEntries(u, filter)
+}
+
+// SetProjectDirectoryInclude sets a directory's include filter, returning the paths of the existing entries that no longer match it.
+func (a *App) SetProjectDirectoryInclude(u uuid.UUID, filter *IncludeFilter) ([]string, error) {
+	if a.Project == nil {
+		return nil, &NoProjectError{}
+	}
+	return a.Project.SetDirectoryInclude(u, filter)
+}
+
+// ImportTagsCSV imports tags and ratings from a CSV file into the entries of the given directory, either merging with or replacing their tags.
+func (a *App) ImportTagsCSV(u uuid.UUID, name string, mode string) (ImportReport, error) {
+	if a.Project == nil {
+		return ImportReport{}, &NoProjectError{}
+	}
+	return a.Project.ImportTagsCSV(u, name, mode)
+}
+
+// ImportCaptions imports tags from the caption sidecar files within the given directory, either merging with or replacing their tags.
+func (a *App) ImportCaptions(u uuid.UUID, mode string) (ImportReport, error) {
+	if a.Project == nil {
+		return ImportReport{}, &NoProjectError{}
+	}
+	return a.Project.ImportCaptions(u, mode)
+}
+
+// ExportCatalog writes every directory and entry of the project to dest as json, csv, or sqlite.
+func (a *App) ExportCatalog(format string, dest string) error {
+	if a.Project == nil {
+		return &NoProjectError{}
+	}
+	return a.Project.ExportCatalog(format, dest)
+}
+
 // LoadFile loads a treesource project file. If the project is unsaved and force is not true, then an UnsavedError is returned.
 func (a *App) LoadProjectFile(name string, force bool) error {
 	err := a.CloseProjectFile(force)
@@ -182,6 +507,11 @@ func (a *App) LoadProjectFile(name string, force bool) error {
 	err = yaml.Unmarshal(b, &a.Project)
 	a.Project.Emitter = *NewEmitter()
 	a.Project.Path = name
+	a.Project.resolvePaths()
+	a.Project.reindex()
+	for i := range a.Project.Directories {
+		a.Project.Directories[i].reindex()
+	}
 	a.Project.history = do.History[*Project]{
 		Target: a.Project,
 	}
@@ -190,53 +520,111 @@ func (a *App) LoadProjectFile(name string, force bool) error {
 }
 
 func (a *App) InitProject() error {
-	for _, d := range a.Project.Directories {
+	if a.thumbnails != nil {
+		a.Project.On(EventDirectoryEntryChange, func(e Event) {
+			if evt, ok := e.(*DirectoryEntryChangeEvent); ok {
+				a.invalidateThumbnails(evt.UUID, evt.Entry.Path)
+			}
+		})
+		a.Project.On(EventDirectoryEntryMove, func(e Event) {
+			if evt, ok := e.(*DirectoryEntryMoveEvent); ok {
+				a.invalidateThumbnails(evt.UUID, evt.From)
+			}
+		})
+		a.Project.On(EventDirectoryEntryMissing, func(e Event) {
+			if evt, ok := e.(*DirectoryEntryMissingEvent); ok {
+				a.invalidateThumbnails(evt.UUID, evt.Entry.Path)
+			}
+		})
+	}
+	a.Project.mutex.Lock()
+	for i := range a.Project.Directories {
+		d := &a.Project.Directories[i]
 		d.Emitter = *NewEmitter()
 		a.Project.Emit(EventDirectoryAdd, DirectoryAddEvent{
 			UUID: d.UUID,
 			Path: d.Path,
 		})
-		if err := a.Project.InitDirectory(&d); err != nil {
-			panic(err)
+	}
+	a.Project.mutex.Unlock()
+	// Directories are synced concurrently, so their entries are only emitted once all are done.
+	err := a.Project.InitDirectories(a.syncContext())
+	a.Project.RLock()
+	for i := range a.Project.Directories {
+		a.Project.Directories[i].EmitAllEntries()
+	}
+	a.Project.RUnlock()
+	return err
+}
+
+// syncContext returns the context that syncs run under, which CancelSync cancels.
+func (a *App) syncContext() context.Context {
+	a.syncing.mutex.Lock()
+	defer a.syncing.mutex.Unlock()
+	if a.syncing.ctx == nil {
+		a.syncing.ctx, a.syncing.cancel = context.WithCancel(context.Background())
+	}
+	return a.syncing.ctx
+}
+
+// SyncProjectDirectories syncs the given directories, or every directory if none are given, concurrently.
+func (a *App) SyncProjectDirectories(uuids []uuid.UUID) error {
+	if a.Project == nil {
+		return &NoProjectError{}
+	}
+	if len(uuids) == 0 {
+		a.Project.RLock()
+		for _, d := range a.Project.Directories {
+			uuids = append(uuids, d.UUID)
 		}
-		d.EmitAllEntries()
+		a.Project.RUnlock()
+	}
+	return a.Project.SyncDirectories(a.syncContext(), uuids)
+}
+
+// CancelSync cancels every running sync. Directories whose syncs are canceled are left as they were.
+func (a *App) CancelSync() {
+	a.syncing.mutex.Lock()
+	defer a.syncing.mutex.Unlock()
+	if a.syncing.cancel != nil {
+		a.syncing.cancel()
+		a.syncing.ctx, a.syncing.cancel = nil, nil
 	}
-	return nil
 }
 
 func (a *App) Undo() {
 	if a.Project == nil {
 		return
 	}
-	a.Project.history.Undo()
+	a.Project.Undo()
 }
 
 func (a *App) Redo() {
 	if a.Project == nil {
 		return
 	}
-	a.Project.history.Redo()
+	a.Project.Redo()
 }
 
 func (a *App) Undoable() bool {
 	if a.Project == nil {
 		return false
 	}
-	return a.Project.history.Undoable()
+	return a.Project.Undoable()
 }
 
 func (a *App) Redoable() bool {
 	if a.Project == nil {
 		return false
 	}
-	return a.Project.history.Redoable()
+	return a.Project.Redoable()
 }
 
 func (a *App) Unsaved() bool {
 	if a.Project == nil {
 		return false
 	}
-	return a.Project.history.SavedPos != a.Project.history.Pos
+	return a.Project.Unsaved()
 }
 
 // CloseProjectFile closes the current project if one exists. If the project is unsaved and force is not true, then an UnsavedError is returned. If no project is open, then NoProjectError is returned.
@@ -247,6 +635,7 @@ func (a *App) CloseProjectFile(force bool) error {
 	if a.Project.Changed() && !force {
 		return &UnsavedError{}
 	}
+	a.Project.StopWatchers()
 	a.Project = nil
 
 	return nil
@@ -264,6 +653,7 @@ func (a *App) QueryFile(root string, path string) (FileInfo, error) {
 	var extra interface{}
 	if strings.HasPrefix(mimetype, "image") {
 		if f, err := os.OpenFile(p, os.O_RDONLY, 0); err == nil {
+			defer f.Close()
 			if img, _, err := image.DecodeConfig(f); err == nil {
 				i := ImageInfo{
 					Width:  img.Width,
@@ -290,9 +680,14 @@ func (a *App) QueryFile(root string, path string) (FileInfo, error) {
 				default:
 					i.ColorModel = "Unknown"
 				}
+				i.Metadata, _ = ReadImageMetadata(p)
 				extra = i
 			}
 		}
+	} else if strings.HasPrefix(mimetype, "audio") {
+		if i, err := ReadAudioInfo(p); err == nil {
+			extra = i
+		}
 	}
 
 	return FileInfo{
@@ -330,19 +725,90 @@ func (a *App) PeekFile(path string, length int) ([]byte, error) {
 	return bytes, nil
 }
 
+// invalidateThumbnails removes the cached thumbnails of the given entry. It is called from entry event handlers, which are emitted while the project is locked.
+func (a *App) invalidateThumbnails(u uuid.UUID, path string) {
+	if d, err := a.Project.GetDirectoryByUUID(u); err == nil {
+		a.thumbnails.Invalidate(filepath.Join(d.Path, path))
+	}
+}
+
+// SetThumbnailCacheLimit sets the size limit of the thumbnail cache in bytes.
+func (a *App) SetThumbnailCacheLimit(limit int64) {
+	if a.thumbnails != nil {
+		a.thumbnails.SetLimit(limit)
+	}
+}
+
+// GenerateThumbnail returns a thumbnail of the given image file, serving it from the thumbnail cache if it has not changed since it was last generated.
 func (a *App) GenerateThumbnail(paths []string, opts ThumbnailOptions) (Thumbnail, error) {
-	path := filepath.Join(paths...)
+	return generateThumbnail(a.thumbnails, filepath.Join(paths...), opts)
+}
+
+// RequestThumbnails queues thumbnails to be generated in the background. Each is emitted as a thumbnail event once generated.
+func (a *App) RequestThumbnails(reqs []ThumbnailRequest) {
+	a.Thumbnailer.Request(reqs)
+}
+
+// PrioritizeThumbnails sets the priority of the given queued thumbnail requests, such as to generate visible thumbnails first.
+func (a *App) PrioritizeThumbnails(ids []string, priority int) {
+	a.Thumbnailer.Prioritize(ids, priority)
+}
+
+// CancelThumbnails cancels the given thumbnail requests, or every request if none are given.
+func (a *App) CancelThumbnails(ids []string) {
+	if len(ids) == 0 {
+		a.Thumbnailer.CancelAll()
+		return
+	}
+	a.Thumbnailer.Cancel(ids)
+}
+
+// generateThumbnail returns a thumbnail of the given image file, using the given cache if it is not nil.
+func generateThumbnail(cache *ThumbnailCache, path string, opts ThumbnailOptions) (Thumbnail, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return Thumbnail{}, err
+	}
 	f, err := os.OpenFile(path, os.O_RDONLY, 0)
 	if err != nil {
 		return Thumbnail{}, err
 	}
 	defer f.Close()
 
+	var info os.FileInfo
+	if cache != nil {
+		if info, err = f.Stat(); err == nil {
+			if t, ok := cache.Get(path, info, opts); ok {
+				return t, nil
+			}
+		}
+	}
+
+	if strings.HasPrefix(mime.TypeByExtension(filepath.Ext(path)), "audio") {
+		t, err := GenerateWaveform(path, opts)
+		if err == nil && info != nil {
+			cache.Put(path, info, opts, t)
+		}
+		return t, err
+	}
+
 	img, format, err := image.Decode(f)
 	if err != nil {
 		return Thumbnail{}, err
 	}
 
+	t, err := encodeThumbnail(ScaleImage(img, opts), format)
+	if err != nil {
+		return Thumbnail{}, err
+	}
+	if info != nil {
+		cache.Put(path, info, opts, t)
+	}
+	return t, nil
+}
+
+// ScaleImage scales the image down to fit within the options' maximum size using the options' scaling method. Images that already fit are only copied.
+func ScaleImage(img image.Image, opts ThumbnailOptions) *image.RGBA {
 	var w, h int
 
 	if img.Bounds().Dx() <= opts.MaxWidth && img.Bounds().Dy() <= opts.MaxHeight {
@@ -363,10 +829,17 @@ func (a *App) GenerateThumbnail(paths []string, opts ThumbnailOptions) (Thumbnai
 	} else {
 		draw.ApproxBiLinear.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Over, nil)
 	}
+	return dst
+}
 
+// encodeThumbnail encodes the image as a PNG thumbnail, labelled with the source's format.
+func encodeThumbnail(img image.Image, format string) (Thumbnail, error) {
 	var b bytes.Buffer
 	o := bufio.NewWriter(&b)
-	if err := png.Encode(o, dst); err != nil {
+	if err := png.Encode(o, img); err != nil {
+		return Thumbnail{}, err
+	}
+	if err := o.Flush(); err != nil {
 		return Thumbnail{}, err
 	}
 	return Thumbnail{
@@ -0,0 +1,592 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dhowden/tag"
+	"github.com/hajimehoshi/go-mp3"
+	"github.com/jfreymuth/oggvorbis"
+	"github.com/mewkiz/flac"
+)
+
+// AudioInfo is the Extra of FileInfo for audio files.
+type AudioInfo struct {
+	Format     string
+	Duration   float64 // Duration is in seconds.
+	SampleRate int
+	Channels   int
+	BitDepth   int // BitDepth is 0 for lossy formats, which have none.
+	Tags       AudioTags
+}
+
+// AudioTags are the tags embedded in an audio file.
+type AudioTags struct {
+	Title   string
+	Artist  string
+	Album   string
+	Genre   string
+	Comment string
+	Year    int
+	Track   int
+}
+
+// UnsupportedAudioError is returned when an audio file's format cannot be decoded.
+type UnsupportedAudioError struct {
+	path string
+}
+
+func (e *UnsupportedAudioError) Error() string {
+	return fmt.Sprintf("unsupported audio format '%s'", e.path)
+}
+
+// AudioHeaderError is returned when an audio file's header describes audio that cannot be decoded, such as a sample rate of zero.
+type AudioHeaderError struct {
+	path   string
+	reason string
+}
+
+func (e *AudioHeaderError) Error() string {
+	return fmt.Sprintf("invalid audio header in '%s': %s", e.path, e.reason)
+}
+
+// checkAudioHeader returns an AudioHeaderError if the given header values cannot be decoded. Lossy formats have no bit depth, so it is only checked if lossless is true.
+func checkAudioHeader(path string, sampleRate, channels, bitDepth int, lossless bool) error {
+	switch {
+	case sampleRate <= 0:
+		return &AudioHeaderError{path, "no sample rate"}
+	case channels <= 0:
+		return &AudioHeaderError{path, "no channels"}
+	case lossless && bitDepth <= 0:
+		return &AudioHeaderError{path, "no bit depth"}
+	}
+	return nil
+}
+
+// audioSource is an opened audio file that can be decoded into samples.
+type audioSource struct {
+	AudioInfo
+	frames int64 // frames is the number of samples per channel.
+	// decode calls fn with each frame's samples averaged across channels, in the range [-1, 1].
+	decode func(fn func(sample float64)) error
+	close  func() error
+}
+
+// openAudio opens the audio file at the given path, choosing the decoder by its extension.
+func openAudio(path string) (*audioSource, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".wav", ".wave":
+		return openWAV(path)
+	case ".flac":
+		return openFLAC(path)
+	case ".ogg", ".oga":
+		return openOggVorbis(path)
+	case ".mp3":
+		return openMP3(path)
+	}
+	return nil, &UnsupportedAudioError{path}
+}
+
+// ReadAudioInfo returns the format, duration, and embedded tags of the audio file at the given path.
+func ReadAudioInfo(path string) (AudioInfo, error) {
+	src, err := openAudio(path)
+	if err != nil {
+		return AudioInfo{}, err
+	}
+	defer src.close()
+	return src.AudioInfo, nil
+}
+
+// readAudioTags reads ID3, Vorbis comment, or FLAC tags from the given file.
+func readAudioTags(f io.ReadSeeker) AudioTags {
+	defer f.Seek(0, io.SeekStart)
+	m, err := tag.ReadFrom(f)
+	if err != nil {
+		return AudioTags{}
+	}
+	track, _ := m.Track()
+	return AudioTags{
+		Title:   m.Title(),
+		Artist:  m.Artist(),
+		Album:   m.Album(),
+		Genre:   m.Genre(),
+		Comment: m.Comment(),
+		Year:    m.Year(),
+		Track:   track,
+	}
+}
+
+// WAV
+
+type wavFormat struct {
+	AudioFormat   uint16
+	Channels      uint16
+	SampleRate    uint32
+	ByteRate      uint32
+	BlockAlign    uint16
+	BitsPerSample uint16
+}
+
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xfffe
+)
+
+// wavMaxInfoSize is the largest LIST chunk that is read for tags.
+const wavMaxInfoSize = 1 << 20
+
+func openWAV(path string) (*audioSource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var header [12]byte
+	if _, err := io.ReadFull(f, header[:]); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		f.Close()
+		return nil, &UnsupportedAudioError{path}
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	var format wavFormat
+	var dataOffset, dataSize int64
+	var tags AudioTags
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(f, chunk[:]); err != nil {
+			break
+		}
+		id := string(chunk[0:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		start, _ := f.Seek(0, io.SeekCurrent)
+		// Chunk sizes are not trusted past the end of the file, such as the placeholder sizes left by streaming writers.
+		if remaining := info.Size() - start; size > remaining {
+			size = remaining
+		}
+		switch id {
+		case "fmt ":
+			if err := binary.Read(f, binary.LittleEndian, &format); err != nil {
+				f.Close()
+				return nil, err
+			}
+			if format.AudioFormat == wavFormatExtensible && size >= 26 {
+				// The actual format is the first two bytes of the sub-format GUID.
+				var sub struct {
+					Size, ValidBits uint16
+					ChannelMask     uint32
+					SubFormat       uint16
+				}
+				if err := binary.Read(f, binary.LittleEndian, &sub); err == nil {
+					format.AudioFormat = sub.SubFormat
+				}
+			}
+		case "data":
+			dataOffset, dataSize = start, size
+		case "LIST":
+			if size > wavMaxInfoSize {
+				break
+			}
+			b := make([]byte, size)
+			if _, err := io.ReadFull(f, b); err == nil {
+				tags = readWAVInfo(b)
+			}
+		}
+		// Chunks are padded to an even size.
+		if _, err := f.Seek(start+size+size%2, io.SeekStart); err != nil {
+			break
+		}
+	}
+
+	if dataOffset == 0 || (format.AudioFormat != wavFormatPCM && format.AudioFormat != wavFormatFloat) {
+		f.Close()
+		return nil, &UnsupportedAudioError{path}
+	}
+	if err := checkAudioHeader(path, int(format.SampleRate), int(format.Channels), int(format.BitsPerSample), true); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if format.BlockAlign < format.Channels {
+		f.Close()
+		return nil, &AudioHeaderError{path, "block smaller than its channels"}
+	}
+
+	frames := dataSize / int64(format.BlockAlign)
+	src := &audioSource{
+		AudioInfo: AudioInfo{
+			Format:     "WAV",
+			Duration:   float64(frames) / float64(format.SampleRate),
+			SampleRate: int(format.SampleRate),
+			Channels:   int(format.Channels),
+			BitDepth:   int(format.BitsPerSample),
+			Tags:       tags,
+		},
+		frames: frames,
+		close:  f.Close,
+	}
+	src.decode = func(fn func(float64)) error {
+		if _, err := f.Seek(dataOffset, io.SeekStart); err != nil {
+			return err
+		}
+		r := bufio.NewReader(io.LimitReader(f, frames*int64(format.BlockAlign)))
+		width := int(format.BlockAlign) / int(format.Channels)
+		frame := make([]byte, format.BlockAlign)
+		for {
+			if _, err := io.ReadFull(r, frame); err != nil {
+				if err == io.EOF || err == io.ErrUnexpectedEOF {
+					return nil
+				}
+				return err
+			}
+			var sum float64
+			for c := 0; c < int(format.Channels); c++ {
+				sum += wavSample(frame[c*width:(c+1)*width], format.AudioFormat)
+			}
+			fn(sum / float64(format.Channels))
+		}
+	}
+	return src, nil
+}
+
+// wavSample converts a little-endian sample to the range [-1, 1].
+func wavSample(b []byte, audioFormat uint16) float64 {
+	if audioFormat == wavFormatFloat {
+		switch len(b) {
+		case 4:
+			return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+		case 8:
+			return math.Float64frombits(binary.LittleEndian.Uint64(b))
+		}
+		return 0
+	}
+	switch len(b) {
+	case 1:
+		// 8-bit samples are unsigned.
+		return (float64(b[0]) - 128) / 128
+	case 2:
+		return float64(int16(binary.LittleEndian.Uint16(b))) / (1 << 15)
+	case 3:
+		v := int32(b[0]) | int32(b[1])<<8 | int32(int8(b[2]))<<16
+		return float64(v) / (1 << 23)
+	case 4:
+		return float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31)
+	}
+	return 0
+}
+
+// readWAVInfo reads the tags of a LIST INFO chunk.
+func readWAVInfo(b []byte) AudioTags {
+	var tags AudioTags
+	if len(b) < 4 || string(b[0:4]) != "INFO" {
+		return tags
+	}
+	b = b[4:]
+	for len(b) >= 8 {
+		id := string(b[0:4])
+		size := int(binary.LittleEndian.Uint32(b[4:8]))
+		b = b[8:]
+		if size > len(b) {
+			break
+		}
+		value := strings.TrimRight(string(b[:size]), "\x00")
+		switch id {
+		case "INAM":
+			tags.Title = value
+		case "IART":
+			tags.Artist = value
+		case "IPRD":
+			tags.Album = value
+		case "IGNR":
+			tags.Genre = value
+		case "ICMT":
+			tags.Comment = value
+		case "ICRD":
+			fmt.Sscanf(value, "%d", &tags.Year)
+		case "ITRK", "IPRT":
+			fmt.Sscanf(value, "%d", &tags.Track)
+		}
+		b = b[size+size%2:]
+	}
+	return tags
+}
+
+// FLAC
+
+func openFLAC(path string) (*audioSource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	tags := readAudioTags(f)
+	stream, err := flac.New(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := checkAudioHeader(path, int(stream.Info.SampleRate), int(stream.Info.NChannels), int(stream.Info.BitsPerSample), true); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &audioSource{
+		AudioInfo: AudioInfo{
+			Format:     "FLAC",
+			Duration:   float64(stream.Info.NSamples) / float64(stream.Info.SampleRate),
+			SampleRate: int(stream.Info.SampleRate),
+			Channels:   int(stream.Info.NChannels),
+			BitDepth:   int(stream.Info.BitsPerSample),
+			Tags:       tags,
+		},
+		frames: int64(stream.Info.NSamples),
+		decode: func(fn func(float64)) error {
+			scale := float64(int64(1) << (stream.Info.BitsPerSample - 1))
+			for {
+				frame, err := stream.ParseNext()
+				if err != nil {
+					if err == io.EOF {
+						return nil
+					}
+					return err
+				}
+				if len(frame.Subframes) == 0 {
+					continue
+				}
+				for i := range frame.Subframes[0].Samples {
+					var sum float64
+					for _, sub := range frame.Subframes {
+						sum += float64(sub.Samples[i])
+					}
+					fn(sum / float64(len(frame.Subframes)) / scale)
+				}
+			}
+		},
+		close: f.Close,
+	}, nil
+}
+
+// Ogg Vorbis
+
+func openOggVorbis(path string) (*audioSource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	tags := readAudioTags(f)
+	r, err := oggvorbis.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := checkAudioHeader(path, r.SampleRate(), r.Channels(), 0, false); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &audioSource{
+		AudioInfo: AudioInfo{
+			Format:     "Ogg Vorbis",
+			Duration:   float64(r.Length()) / float64(r.SampleRate()),
+			SampleRate: r.SampleRate(),
+			Channels:   r.Channels(),
+			Tags:       tags,
+		},
+		frames: r.Length(),
+		decode: func(fn func(float64)) error {
+			channels := r.Channels()
+			buf := make([]float32, 4096*channels)
+			for {
+				n, err := r.Read(buf)
+				for i := 0; i+channels <= n; i += channels {
+					var sum float64
+					for c := 0; c < channels; c++ {
+						sum += float64(buf[i+c])
+					}
+					fn(sum / float64(channels))
+				}
+				if err != nil {
+					if err == io.EOF {
+						return nil
+					}
+					return err
+				}
+			}
+		},
+		close: f.Close,
+	}, nil
+}
+
+// MP3
+
+func openMP3(path string) (*audioSource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	tags := readAudioTags(f)
+	channels := mp3Channels(f)
+	d, err := mp3.NewDecoder(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	// The channels are only looked for to be reported, as the decoder always produces stereo.
+	if err := checkAudioHeader(path, d.SampleRate(), 2, 0, false); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// The decoder always produces 16-bit stereo.
+	frames := d.Length() / 4
+	return &audioSource{
+		AudioInfo: AudioInfo{
+			Format:     "MP3",
+			Duration:   float64(frames) / float64(d.SampleRate()),
+			SampleRate: d.SampleRate(),
+			Channels:   channels,
+			Tags:       tags,
+		},
+		frames: frames,
+		decode: func(fn func(float64)) error {
+			r := bufio.NewReader(d)
+			var frame [4]byte
+			for {
+				if _, err := io.ReadFull(r, frame[:]); err != nil {
+					if err == io.EOF || err == io.ErrUnexpectedEOF {
+						return nil
+					}
+					return err
+				}
+				left := float64(int16(binary.LittleEndian.Uint16(frame[0:2])))
+				right := float64(int16(binary.LittleEndian.Uint16(frame[2:4])))
+				fn((left + right) / 2 / (1 << 15))
+			}
+		},
+		close: f.Close,
+	}, nil
+}
+
+// mp3Channels returns the channel count of the first MPEG audio frame, skipping any ID3v2 tag.
+func mp3Channels(f io.ReadSeeker) int {
+	defer f.Seek(0, io.SeekStart)
+	var header [10]byte
+	if _, err := io.ReadFull(f, header[:]); err != nil {
+		return 0
+	}
+	offset := int64(0)
+	if string(header[0:3]) == "ID3" {
+		// The tag size is a 28-bit syncsafe integer.
+		size := int64(header[6])<<21 | int64(header[7])<<14 | int64(header[8])<<7 | int64(header[9])
+		offset = 10 + size
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0
+	}
+	r := bufio.NewReader(f)
+	var prev byte
+	for i := 0; i < 64*1024; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0
+		}
+		if prev == 0xff && b&0xe0 == 0xe0 {
+			if _, err := r.ReadByte(); err != nil {
+				return 0
+			}
+			mode, err := r.ReadByte()
+			if err != nil {
+				return 0
+			}
+			// Channel mode 3 is single channel.
+			if mode>>6 == 3 {
+				return 1
+			}
+			return 2
+		}
+		prev = b
+	}
+	return 0
+}
+
+// Waveforms
+
+// WaveformColor is the color waveform thumbnails are drawn with.
+var WaveformColor = color.NRGBA{0x4a, 0x90, 0xd9, 0xff}
+
+// GenerateWaveform renders a waveform of the audio file at the given path as a PNG thumbnail of the given maximum size.
+func GenerateWaveform(path string, opts ThumbnailOptions) (Thumbnail, error) {
+	src, err := openAudio(path)
+	if err != nil {
+		return Thumbnail{}, err
+	}
+	defer src.close()
+
+	w, h := opts.MaxWidth, opts.MaxHeight
+	if w <= 0 {
+		w = 256
+	}
+	if h <= 0 {
+		h = w / 2
+	}
+	if src.frames <= 0 {
+		return Thumbnail{}, errors.New("audio has no samples")
+	}
+
+	// Track the peaks of each column.
+	mins := make([]float64, w)
+	maxs := make([]float64, w)
+	var i int64
+	err = src.decode(func(sample float64) {
+		x := int(i * int64(w) / src.frames)
+		if x >= w {
+			x = w - 1
+		}
+		if sample < mins[x] {
+			mins[x] = sample
+		}
+		if sample > maxs[x] {
+			maxs[x] = sample
+		}
+		i++
+	})
+	if err != nil && i == 0 {
+		return Thumbnail{}, err
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	mid := float64(h-1) / 2
+	for x := 0; x < w; x++ {
+		top := int(math.Round(mid - math.Min(maxs[x], 1)*mid))
+		bottom := int(math.Round(mid - math.Max(mins[x], -1)*mid))
+		for y := top; y <= bottom; y++ {
+			img.SetNRGBA(x, y, WaveformColor)
+		}
+	}
+
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		return Thumbnail{}, err
+	}
+	return Thumbnail{
+		Bytes:  b.Bytes(),
+		Format: "png",
+	}, nil
+}
@@ -0,0 +1,78 @@
+package lib
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// wavFile returns a WAV file with the given format and a second of silence at its sample rate.
+func wavFile(format wavFormat) []byte {
+	fmtChunk := make([]byte, 16)
+	binary.LittleEndian.PutUint16(fmtChunk[0:], format.AudioFormat)
+	binary.LittleEndian.PutUint16(fmtChunk[2:], format.Channels)
+	binary.LittleEndian.PutUint32(fmtChunk[4:], format.SampleRate)
+	binary.LittleEndian.PutUint32(fmtChunk[8:], format.ByteRate)
+	binary.LittleEndian.PutUint16(fmtChunk[12:], format.BlockAlign)
+	binary.LittleEndian.PutUint16(fmtChunk[14:], format.BitsPerSample)
+	data := make([]byte, int(format.SampleRate)*int(format.BlockAlign))
+
+	b := []byte("RIFF\x00\x00\x00\x00WAVE")
+	for _, c := range []struct {
+		id   string
+		data []byte
+	}{{"fmt ", fmtChunk}, {"data", data}} {
+		size := make([]byte, 4)
+		binary.LittleEndian.PutUint32(size, uint32(len(c.data)))
+		b = append(append(append(b, c.id...), size...), c.data...)
+	}
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(b)-8))
+	return b
+}
+
+func TestReadAudioInfoWAV(t *testing.T) {
+	valid := wavFormat{AudioFormat: wavFormatPCM, Channels: 2, SampleRate: 8000, ByteRate: 32000, BlockAlign: 4, BitsPerSample: 16}
+	tests := []struct {
+		name    string
+		format  func(f *wavFormat)
+		wantErr error // wantErr is the type of error wanted, if any.
+	}{
+		{"valid", func(f *wavFormat) {}, nil},
+		{"no sample rate", func(f *wavFormat) { f.SampleRate = 0 }, &AudioHeaderError{}},
+		{"no channels", func(f *wavFormat) { f.Channels = 0 }, &AudioHeaderError{}},
+		{"no bit depth", func(f *wavFormat) { f.BitsPerSample = 0 }, &AudioHeaderError{}},
+		{"block smaller than its channels", func(f *wavFormat) { f.BlockAlign = 1 }, &AudioHeaderError{}},
+		{"no block", func(f *wavFormat) { f.BlockAlign = 0 }, &AudioHeaderError{}},
+		{"compressed", func(f *wavFormat) { f.AudioFormat = 2 }, &UnsupportedAudioError{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format := valid
+			tt.format(&format)
+			path := filepath.Join(t.TempDir(), "audio.wav")
+			if err := os.WriteFile(path, wavFile(format), 0644); err != nil {
+				t.Fatal(err)
+			}
+			info, err := ReadAudioInfo(path)
+			switch want := tt.wantErr.(type) {
+			case nil:
+				if err != nil {
+					t.Fatalf("ReadAudioInfo() error = %v", err)
+				}
+				if info.Duration != 1 || info.SampleRate != 8000 || info.Channels != 2 || info.BitDepth != 16 {
+					t.Errorf("ReadAudioInfo() = %+v, want a second of 8000 Hz 16-bit stereo", info)
+				}
+			case *AudioHeaderError:
+				if !errors.As(err, &want) {
+					t.Errorf("ReadAudioInfo() error = %v, want an AudioHeaderError", err)
+				}
+			case *UnsupportedAudioError:
+				if !errors.As(err, &want) {
+					t.Errorf("ReadAudioInfo() error = %v, want an UnsupportedAudioError", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package lib
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Catalog formats.
+const (
+	CatalogJSON   = "json"
+	CatalogCSV    = "csv"
+	CatalogSQLite = "sqlite"
+)
+
+// Catalog is a flattened view of a project's directories and entries for use by other tools.
+type Catalog struct {
+	Title       string             `json:"Title"`
+	Directories []CatalogDirectory `json:"Directories"`
+	Entries     []CatalogEntry     `json:"Entries"`
+}
+
+// CatalogDirectory is a directory within a catalog.
+type CatalogDirectory struct {
+	UUID       uuid.UUID `json:"UUID"`
+	Path       string    `json:"Path"`
+	IgnoreDot  bool      `json:"IgnoreDot"`
+	SyncOnLoad bool      `json:"SyncOnLoad"`
+	Watch      bool      `json:"Watch"`
+	Entries    int       `json:"Entries"`
+}
+
+// CatalogEntry is an entry within a catalog, along with the directory that owns it.
+type CatalogEntry struct {
+	Directory     uuid.UUID `json:"Directory"`
+	DirectoryPath string    `json:"DirectoryPath"`
+	Path          string    `json:"Path"`
+	Tags          []string  `json:"Tags"`
+	Rating        float64   `json:"Rating"`
+	Missing       bool      `json:"Missing"`
+	Size          int64     `json:"Size"`
+	ModTime       time.Time `json:"ModTime"`
+	Hash          string    `json:"Hash"`
+}
+
+// CatalogFormatError is returned when an unknown catalog format is requested.
+type CatalogFormatError struct {
+	format string
+}
+
+func (e *CatalogFormatError) Error() string {
+	return fmt.Sprintf("unknown catalog format '%s'", e.format)
+}
+
+// CatalogUnavailableError is returned when a catalog format is not supported by this build.
+type CatalogUnavailableError struct {
+	format string
+	reason string
+}
+
+func (e *CatalogUnavailableError) Error() string {
+	return fmt.Sprintf("catalog format '%s' is not available: %s", e.format, e.reason)
+}
+
+// Catalog returns the project's directories and entries as a catalog. Paths are separated by `/`, as in the project file.
+func (p *Project) Catalog() Catalog {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	c := Catalog{
+		Title:       p.Title,
+		Directories: make([]CatalogDirectory, 0, len(p.Directories)),
+		Entries:     make([]CatalogEntry, 0),
+	}
+	for _, d := range p.Directories {
+		dirPath := filepath.ToSlash(d.Path)
+		c.Directories = append(c.Directories, CatalogDirectory{
+			UUID:       d.UUID,
+			Path:       dirPath,
+			IgnoreDot:  d.IgnoreDot,
+			SyncOnLoad: d.SyncOnLoad,
+			Watch:      d.Watch,
+			Entries:    len(d.Entries),
+		})
+		for _, e := range d.Entries {
+			c.Entries = append(c.Entries, CatalogEntry{
+				Directory:     d.UUID,
+				DirectoryPath: dirPath,
+				Path:          filepath.ToSlash(e.Path),
+				Tags:          append([]string{}, e.Tags...),
+				Rating:        e.Rating,
+				Missing:       e.Missing,
+				Size:          e.Size,
+				ModTime:       e.ModTime,
+				Hash:          e.Hash,
+			})
+		}
+	}
+	return c
+}
+
+// ExportCatalog writes the project's catalog to dest in the given format, replacing dest if it exists.
+func (p *Project) ExportCatalog(format string, dest string) error {
+	c := p.Catalog()
+	switch format {
+	case CatalogJSON, CatalogCSV:
+		f, err := os.Create(dest)
+		if err != nil {
+			return err
+		}
+		if format == CatalogJSON {
+			err = c.WriteJSON(f)
+		} else {
+			err = c.WriteCSV(f)
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	case CatalogSQLite:
+		return c.WriteSQLite(dest)
+	}
+	return &CatalogFormatError{format}
+}
+
+// WriteJSON writes the catalog as indented JSON.
+func (c Catalog) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(c)
+}
+
+// WriteCSV writes the catalog's entries as CSV, one row per entry, with tags joined by commas.
+func (c Catalog) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"directory", "directory_path", "path", "tags", "rating", "missing", "size", "mod_time", "hash"})
+	for _, e := range c.Entries {
+		cw.Write([]string{
+			e.Directory.String(),
+			e.DirectoryPath,
+			e.Path,
+			strings.Join(e.Tags, ","),
+			strconv.FormatFloat(e.Rating, 'f', -1, 64),
+			strconv.FormatBool(e.Missing),
+			strconv.FormatInt(e.Size, 10),
+			e.ModTime.Format(time.RFC3339Nano),
+			e.Hash,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+const catalogSchema = `
+CREATE TABLE directories (
+	uuid TEXT PRIMARY KEY,
+	path TEXT NOT NULL,
+	ignore_dot INTEGER NOT NULL,
+	sync_on_load INTEGER NOT NULL,
+	watch INTEGER NOT NULL
+);
+CREATE TABLE entries (
+	id INTEGER PRIMARY KEY,
+	directory TEXT NOT NULL REFERENCES directories(uuid),
+	path TEXT NOT NULL,
+	rating REAL NOT NULL,
+	missing INTEGER NOT NULL,
+	size INTEGER NOT NULL,
+	mod_time TEXT NOT NULL,
+	hash TEXT NOT NULL,
+	UNIQUE (directory, path)
+);
+CREATE TABLE tags (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE
+);
+CREATE TABLE entry_tags (
+	entry INTEGER NOT NULL REFERENCES entries(id),
+	tag INTEGER NOT NULL REFERENCES tags(id),
+	PRIMARY KEY (entry, tag)
+);
+CREATE INDEX entry_tags_tag ON entry_tags(tag);
+`
+
+// WriteSQLite writes the catalog to a new SQLite database at path, with directories, entries, tags, and entry_tags tables. The SQLite driver requires cgo, so builds without it return a CatalogUnavailableError.
+func (c Catalog) WriteSQLite(path string) error {
+	if sqliteDriver == "" {
+		return &CatalogUnavailableError{CatalogSQLite, "built without cgo, which the SQLite driver requires"}
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	db, err := sql.Open(sqliteDriver, path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(catalogSchema); err != nil {
+		return err
+	}
+	for _, d := range c.Directories {
+		if _, err := tx.Exec(`INSERT INTO directories (uuid, path, ignore_dot, sync_on_load, watch) VALUES (?, ?, ?, ?, ?)`, d.UUID.String(), d.Path, d.IgnoreDot, d.SyncOnLoad, d.Watch); err != nil {
+			return err
+		}
+	}
+
+	insertEntry, err := tx.Prepare(`INSERT INTO entries (directory, path, rating, missing, size, mod_time, hash) VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insertEntry.Close()
+	insertTag, err := tx.Prepare(`INSERT INTO tags (name) VALUES (?)`)
+	if err != nil {
+		return err
+	}
+	defer insertTag.Close()
+	insertEntryTag, err := tx.Prepare(`INSERT OR IGNORE INTO entry_tags (entry, tag) VALUES (?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insertEntryTag.Close()
+
+	tags := make(map[string]int64)
+	for _, e := range c.Entries {
+		res, err := insertEntry.Exec(e.Directory.String(), e.Path, e.Rating, e.Missing, e.Size, e.ModTime.Format(time.RFC3339Nano), e.Hash)
+		if err != nil {
+			return err
+		}
+		entry, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		for _, t := range e.Tags {
+			tag, ok := tags[t]
+			if !ok {
+				res, err := insertTag.Exec(t)
+				if err != nil {
+					return err
+				}
+				if tag, err = res.LastInsertId(); err != nil {
+					return err
+				}
+				tags[t] = tag
+			}
+			if _, err := insertEntryTag.Exec(entry, tag); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,6 @@
+//go:build !cgo
+
+package lib
+
+// sqliteDriver is empty as the SQLite driver requires cgo.
+const sqliteDriver = ""
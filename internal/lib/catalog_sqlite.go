@@ -0,0 +1,8 @@
+//go:build cgo
+
+package lib
+
+import _ "github.com/mattn/go-sqlite3"
+
+// sqliteDriver is the database/sql driver used to write SQLite catalogs.
+const sqliteDriver = "sqlite3"
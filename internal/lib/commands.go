@@ -0,0 +1,1142 @@
+package lib
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Command is a non-interactive operation against a project file.
+type Command struct {
+	Usage string
+	Run   func(a *App, args []string) (interface{}, error)
+}
+
+const (
+	usageNew       = "new [-ignore-dot] <project> [directory]"
+	usageAddDir    = "add-dir [-ignore-dot] <project> <directory>"
+	usageRemoveDir = "remove-dir <project> <directory|uuid>"
+	usageSync      = "sync <project> [directory|uuid...]"
+	usageTag       = "tag add|remove <project> <directory|uuid> <path> <tag...> | tag move <project> <tag> <parent>"
+	usageTags      = "tags <project>"
+	usageAlias     = "alias set <project> <alias> <tag> | alias remove <project> <alias>"
+	usageImply     = "imply add|remove <project> <tag> <implied>"
+	usageRate      = "rate <project> <directory|uuid> <path> <rating>"
+	usageLs        = "ls <project> [directory|uuid]"
+	usageQuery     = "query <project> <expression...>"
+	usageDupes     = "dupes <project>"
+	usageSimilar   = "similar [-method pHash] [-threshold 10] <project> <directory|uuid> <path>"
+	usageSheet     = "sheet grid [-margin n] [-spacing n] [-columns n] [-rows n] <project> <directory|uuid> <path> <width> <height> | sheet frame <project> <directory|uuid> <path> <name> <x> <y> <width> <height> | sheet clear|export <project> <directory|uuid> <path> [destination]"
+	usageAnimate   = "animate [-format gif|apng] [-duration ms] [-loops n] [-width n] [-height n] [-method m] <project> <directory|uuid> <output> <path[#frame]...>"
+	usageExport    = "export [-mode copy|hardlink|symlink] [-flatten] [-dry-run] <project> <destination> <expression...>"
+	usageCatalog   = "catalog [-format json|csv|sqlite] <project> <output>"
+	usageImport    = "import csv [-replace] <project> <directory|uuid> <file> | import captions [-replace] <project> <directory|uuid>"
+	usageXMP       = "xmp mode <project> <directory|uuid> read|write|both|off | xmp sync <project> <directory|uuid> | xmp resolve <project> <directory|uuid> <path> project|sidecar"
+	usageIgnore    = "ignore show <project> <directory|uuid> | ignore set|preview <project> <directory|uuid> [pattern...]"
+	usageInclude   = "include show <project> <directory|uuid> | include set|preview [-ext list] [-mime list] [-min-size n] [-max-size n] <project> <directory|uuid>"
+	usageLinks     = "links <project> <directory|uuid> follow|skip"
+	usageRelocate  = "relocate <project> <directory|uuid> <path>"
+	usageRelative  = "relative <project> <directory|uuid> on|off"
+	usageSave      = "save <project>"
+)
+
+// Commands are the subcommands available through RunCommand.
+var Commands = map[string]Command{
+	"new": {
+		Usage: usageNew,
+		Run:   commandNew,
+	},
+	"add-dir": {
+		Usage: usageAddDir,
+		Run:   commandAddDir,
+	},
+	"remove-dir": {
+		Usage: usageRemoveDir,
+		Run:   commandRemoveDir,
+	},
+	"sync": {
+		Usage: usageSync,
+		Run:   commandSync,
+	},
+	"tag": {
+		Usage: usageTag,
+		Run:   commandTag,
+	},
+	"tags": {
+		Usage: usageTags,
+		Run:   commandTags,
+	},
+	"alias": {
+		Usage: usageAlias,
+		Run:   commandAlias,
+	},
+	"imply": {
+		Usage: usageImply,
+		Run:   commandImply,
+	},
+	"rate": {
+		Usage: usageRate,
+		Run:   commandRate,
+	},
+	"ls": {
+		Usage: usageLs,
+		Run:   commandLs,
+	},
+	"query": {
+		Usage: usageQuery,
+		Run:   commandQuery,
+	},
+	"dupes": {
+		Usage: usageDupes,
+		Run:   commandDupes,
+	},
+	"similar": {
+		Usage: usageSimilar,
+		Run:   commandSimilar,
+	},
+	"sheet": {
+		Usage: usageSheet,
+		Run:   commandSheet,
+	},
+	"animate": {
+		Usage: usageAnimate,
+		Run:   commandAnimate,
+	},
+	"export": {
+		Usage: usageExport,
+		Run:   commandExport,
+	},
+	"catalog": {
+		Usage: usageCatalog,
+		Run:   commandCatalog,
+	},
+	"import": {
+		Usage: usageImport,
+		Run:   commandImport,
+	},
+	"xmp": {
+		Usage: usageXMP,
+		Run:   commandXMP,
+	},
+	"ignore": {
+		Usage: usageIgnore,
+		Run:   commandIgnore,
+	},
+	"include": {
+		Usage: usageInclude,
+		Run:   commandInclude,
+	},
+	"links": {
+		Usage: usageLinks,
+		Run:   commandLinks,
+	},
+	"relocate": {
+		Usage: usageRelocate,
+		Run:   commandRelocate,
+	},
+	"relative": {
+		Usage: usageRelative,
+		Run:   commandRelative,
+	},
+	"save": {
+		Usage: usageSave,
+		Run:   commandSave,
+	},
+}
+
+// CommandDirectory is the JSON representation of a directory returned by commands.
+type CommandDirectory struct {
+	UUID        uuid.UUID `json:"UUID"`
+	Path        string    `json:"Path"`
+	IgnoreDot   bool      `json:"IgnoreDot"`
+	SyncOnLoad  bool      `json:"SyncOnLoad"`
+	FollowLinks bool      `json:"FollowLinks"`
+	Relative    bool      `json:"Relative"`
+	Entries     int       `json:"Entries"`
+	Missing     int       `json:"Missing"`
+	Linked      int       `json:"Linked"`
+}
+
+// CommandProject is the JSON representation of a project returned by commands.
+type CommandProject struct {
+	Title       string             `json:"Title"`
+	Path        string             `json:"Path"`
+	Directories []CommandDirectory `json:"Directories"`
+}
+
+// CommandEntry is the JSON representation of an entry returned by commands.
+type CommandEntry struct {
+	Directory uuid.UUID `json:"Directory"`
+	DirectoryEntry
+}
+
+// CommandSync is the JSON representation of a directory sync returned by commands.
+type CommandSync struct {
+	UUID    uuid.UUID `json:"UUID"`
+	Path    string    `json:"Path"`
+	Added   int       `json:"Added"`
+	Missing int       `json:"Missing"`
+	Found   int       `json:"Found"`
+	Moved   int       `json:"Moved"`
+	Error   string    `json:"Error,omitempty"`
+}
+
+// CommandDuplicates is the JSON representation of a group of duplicate files returned by commands.
+type CommandDuplicates struct {
+	Hash    string         `json:"Hash"`
+	Size    int64          `json:"Size"`
+	Entries []CommandEntry `json:"Entries"`
+}
+
+// CommandSimilar is the JSON representation of a visually similar entry returned by commands.
+type CommandSimilar struct {
+	CommandEntry
+	Distance int `json:"Distance"`
+}
+
+// CommandError is written in place of a result when a command fails.
+type CommandError struct {
+	Error    string `json:"Error"`
+	Position *int   `json:"Position,omitempty"` // Position is set for query parse errors.
+}
+
+// UsageError is returned when a command is called with bad arguments.
+type UsageError struct {
+	usage string
+}
+
+func (e *UsageError) Error() string {
+	return fmt.Sprintf("usage: treesource %s", e.usage)
+}
+
+// UnknownCommandError is returned when a command does not exist.
+type UnknownCommandError struct {
+	command string
+}
+
+func (e *UnknownCommandError) Error() string {
+	return fmt.Sprintf("unknown command '%s'", e.command)
+}
+
+// IsCommand returns if the given name is an available command.
+func IsCommand(name string) bool {
+	_, ok := Commands[name]
+	return ok || name == "help"
+}
+
+// RunCommand runs the command named by the first argument and writes its result or error to out as JSON.
+func (a *App) RunCommand(args []string, out io.Writer) error {
+	var result interface{}
+	var err error
+	if len(args) == 0 {
+		err = &UnknownCommandError{}
+	} else if args[0] == "help" {
+		result = CommandUsage()
+	} else if c, ok := Commands[args[0]]; !ok {
+		err = &UnknownCommandError{args[0]}
+	} else {
+		result, err = c.Run(a, args[1:])
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	if err != nil {
+		cerr := CommandError{
+			Error: err.Error(),
+		}
+		if perr, ok := err.(*QueryParseError); ok {
+			cerr.Position = &perr.Position
+		}
+		enc.Encode(cerr)
+		return err
+	}
+	return enc.Encode(result)
+}
+
+// loadCommandProject loads the given project file and readies its directories without syncing them.
+func (a *App) loadCommandProject(name string) error {
+	if err := a.LoadProjectFile(name, true); err != nil {
+		return err
+	}
+	for i := range a.Project.Directories {
+		a.Project.Directories[i].Emitter = *NewEmitter()
+		a.Project.Directories[i].Separator = string(filepath.Separator)
+	}
+	return nil
+}
+
+// FindDirectory finds a directory by its UUID or its path.
+func (p *Project) FindDirectory(s string) (*Directory, error) {
+	if u, err := uuid.Parse(s); err == nil {
+		for i := range p.Directories {
+			if p.Directories[i].UUID == u {
+				return &p.Directories[i], nil
+			}
+		}
+	}
+	abs, _ := filepath.Abs(s)
+	for i := range p.Directories {
+		if p.Directories[i].Path == s || p.Directories[i].Path == abs {
+			return &p.Directories[i], nil
+		}
+	}
+	return nil, &MissingDirectoryError{
+		dir: s,
+	}
+}
+
+func (p *Project) commandProject() CommandProject {
+	c := CommandProject{
+		Title:       p.Title,
+		Path:        p.Path,
+		Directories: make([]CommandDirectory, 0),
+	}
+	for i := range p.Directories {
+		c.Directories = append(c.Directories, p.Directories[i].commandDirectory())
+	}
+	return c
+}
+
+func (d *Directory) commandDirectory() CommandDirectory {
+	c := CommandDirectory{
+		UUID:        d.UUID,
+		Path:        d.Path,
+		IgnoreDot:   d.IgnoreDot,
+		SyncOnLoad:  d.SyncOnLoad,
+		FollowLinks: d.FollowLinks,
+		Relative:    d.Relative,
+		Entries:     len(d.Entries),
+	}
+	for _, e := range d.Entries {
+		if e.Linked {
+			c.Linked++
+		}
+		if e.Missing {
+			c.Missing++
+		}
+	}
+	return c
+}
+
+func commandEntry(d *Directory, e *DirectoryEntry) CommandEntry {
+	c := CommandEntry{
+		Directory:      d.UUID,
+		DirectoryEntry: e.Clone(),
+	}
+	c.Path = filepath.ToSlash(c.Path)
+	return c
+}
+
+func commandNew(a *App, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("new", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	ignoreDot := fs.Bool("ignore-dot", true, "ignore dot files")
+	if err := fs.Parse(args); err != nil || fs.NArg() < 1 || fs.NArg() > 2 {
+		return nil, &UsageError{usageNew}
+	}
+	var dir string
+	if fs.NArg() == 2 {
+		var err error
+		if dir, err = filepath.Abs(fs.Arg(1)); err != nil {
+			return nil, err
+		}
+	}
+	if err := a.NewProject(fs.Arg(0), dir, *ignoreDot); err != nil {
+		return nil, err
+	}
+	return a.Project.commandProject(), nil
+}
+
+func commandAddDir(a *App, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("add-dir", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	ignoreDot := fs.Bool("ignore-dot", true, "ignore dot files")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 2 {
+		return nil, &UsageError{usageAddDir}
+	}
+	if err := a.loadCommandProject(fs.Arg(0)); err != nil {
+		return nil, err
+	}
+	dir, err := filepath.Abs(fs.Arg(1))
+	if err != nil {
+		return nil, err
+	}
+	if err := a.AddProjectDirectory(dir, *ignoreDot); err != nil {
+		return nil, err
+	}
+	if err := a.SaveProject(true); err != nil {
+		return nil, err
+	}
+	return a.Project.Directories[len(a.Project.Directories)-1].commandDirectory(), nil
+}
+
+func commandRemoveDir(a *App, args []string) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, &UsageError{usageRemoveDir}
+	}
+	if err := a.loadCommandProject(args[0]); err != nil {
+		return nil, err
+	}
+	d, err := a.Project.FindDirectory(args[1])
+	if err != nil {
+		return nil, err
+	}
+	result := d.commandDirectory()
+	if err := a.RemoveProjectDirectory(d.UUID); err != nil {
+		return nil, err
+	}
+	if err := a.SaveProject(true); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func commandSync(a *App, args []string) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, &UsageError{usageSync}
+	}
+	if err := a.loadCommandProject(args[0]); err != nil {
+		return nil, err
+	}
+	var dirs []*Directory
+	if len(args) == 1 {
+		for i := range a.Project.Directories {
+			dirs = append(dirs, &a.Project.Directories[i])
+		}
+	} else {
+		for _, s := range args[1:] {
+			d, err := a.Project.FindDirectory(s)
+			if err != nil {
+				return nil, err
+			}
+			dirs = append(dirs, d)
+		}
+	}
+
+	results := make([]CommandSync, 0)
+	for _, d := range dirs {
+		r := CommandSync{
+			UUID: d.UUID,
+			Path: d.Path,
+		}
+		d.On("add", func(e Event) { r.Added++ })
+		d.On("missing", func(e Event) { r.Missing++ })
+		d.On("found", func(e Event) { r.Found++ })
+		d.On("move", func(e Event) { r.Moved++ })
+		if err := d.SyncEntries(); err != nil {
+			r.Error = err.Error()
+		}
+		results = append(results, r)
+	}
+	if err := a.SaveProject(true); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// commandEntryTarget loads the project and finds the directory and entry referred to by args.
+func (a *App) commandEntryTarget(project, dir, path string) (*Directory, *DirectoryEntry, error) {
+	if err := a.loadCommandProject(project); err != nil {
+		return nil, nil, err
+	}
+	d, err := a.Project.FindDirectory(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	path = filepath.FromSlash(path)
+	e := d.Entry(path)
+	if e == nil {
+		return nil, nil, &MissingEntryError{
+			dir:  d.Path,
+			path: path,
+		}
+	}
+	return d, e, nil
+}
+
+func commandTag(a *App, args []string) (interface{}, error) {
+	if len(args) == 4 && args[0] == "move" {
+		if err := a.loadCommandProject(args[1]); err != nil {
+			return nil, err
+		}
+		if err := a.MoveProjectTag(args[2], args[3]); err != nil {
+			return nil, err
+		}
+		if err := a.SaveProject(true); err != nil {
+			return nil, err
+		}
+		return a.Project.TagTree(), nil
+	}
+	if len(args) < 5 || (args[0] != "add" && args[0] != "remove") {
+		return nil, &UsageError{usageTag}
+	}
+	d, e, err := a.commandEntryTarget(args[1], args[2], args[3])
+	if err != nil {
+		return nil, err
+	}
+
+	entry := e.Clone()
+	for _, tag := range args[4:] {
+		index := -1
+		for i, t := range entry.Tags {
+			if t == tag {
+				index = i
+				break
+			}
+		}
+		if args[0] == "add" && index == -1 {
+			entry.Tags = append(entry.Tags, tag)
+		} else if args[0] == "remove" && index != -1 {
+			entry.Tags = append(entry.Tags[:index], entry.Tags[index+1:]...)
+		}
+	}
+
+	if err := a.UpdateProjectDirectoryEntry(d.UUID, e.Path, entry); err != nil {
+		return nil, err
+	}
+	if err := a.SaveProject(true); err != nil {
+		return nil, err
+	}
+	return commandEntry(d, e), nil
+}
+
+func commandTags(a *App, args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, &UsageError{usageTags}
+	}
+	if err := a.loadCommandProject(args[0]); err != nil {
+		return nil, err
+	}
+	return a.Project.TagTree(), nil
+}
+
+func commandAlias(a *App, args []string) (interface{}, error) {
+	if !(len(args) == 4 && args[0] == "set") && !(len(args) == 3 && args[0] == "remove") {
+		return nil, &UsageError{usageAlias}
+	}
+	if err := a.loadCommandProject(args[1]); err != nil {
+		return nil, err
+	}
+	var err error
+	if args[0] == "set" {
+		err = a.SetProjectTagAlias(args[2], args[3])
+	} else {
+		err = a.RemoveProjectTagAlias(args[2])
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := a.SaveProject(true); err != nil {
+		return nil, err
+	}
+	return a.Project.TagRegistry, nil
+}
+
+func commandImply(a *App, args []string) (interface{}, error) {
+	if len(args) != 4 || (args[0] != "add" && args[0] != "remove") {
+		return nil, &UsageError{usageImply}
+	}
+	if err := a.loadCommandProject(args[1]); err != nil {
+		return nil, err
+	}
+	var err error
+	if args[0] == "add" {
+		err = a.AddProjectTagImplication(args[2], args[3])
+	} else {
+		err = a.RemoveProjectTagImplication(args[2], args[3])
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := a.SaveProject(true); err != nil {
+		return nil, err
+	}
+	return a.Project.TagRegistry, nil
+}
+
+func commandRate(a *App, args []string) (interface{}, error) {
+	if len(args) != 4 {
+		return nil, &UsageError{usageRate}
+	}
+	rating, err := strconv.ParseFloat(args[3], 64)
+	if err != nil {
+		return nil, &UsageError{usageRate}
+	}
+	d, e, err := a.commandEntryTarget(args[0], args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	entry := e.Clone()
+	entry.Rating = rating
+
+	if err := a.UpdateProjectDirectoryEntry(d.UUID, e.Path, entry); err != nil {
+		return nil, err
+	}
+	if err := a.SaveProject(true); err != nil {
+		return nil, err
+	}
+	return commandEntry(d, e), nil
+}
+
+func commandLs(a *App, args []string) (interface{}, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, &UsageError{usageLs}
+	}
+	if err := a.loadCommandProject(args[0]); err != nil {
+		return nil, err
+	}
+	if len(args) == 1 {
+		return a.Project.commandProject(), nil
+	}
+	d, err := a.Project.FindDirectory(args[1])
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]CommandEntry, 0)
+	for _, e := range d.Entries {
+		entries = append(entries, commandEntry(d, e))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries, nil
+}
+
+func commandQuery(a *App, args []string) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, &UsageError{usageQuery}
+	}
+	if err := a.loadCommandProject(args[0]); err != nil {
+		return nil, err
+	}
+	q, err := ParseQuery(strings.Join(args[1:], " "))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]CommandEntry, 0)
+	for _, m := range a.Project.Query(q) {
+		d, _ := a.Project.GetDirectoryByUUID(m.Directory)
+		entries = append(entries, commandEntry(d, m.Entry))
+	}
+	return entries, nil
+}
+
+func commandDupes(a *App, args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, &UsageError{usageDupes}
+	}
+	if err := a.loadCommandProject(args[0]); err != nil {
+		return nil, err
+	}
+	groups, err := a.FindDuplicates()
+	if err != nil {
+		return nil, err
+	}
+	results := make([]CommandDuplicates, 0)
+	for _, g := range groups {
+		r := CommandDuplicates{
+			Hash: g.Hash,
+			Size: g.Size,
+		}
+		for _, m := range g.Entries {
+			d, _ := a.Project.GetDirectoryByUUID(m.Directory)
+			r.Entries = append(r.Entries, commandEntry(d, m.Entry))
+		}
+		results = append(results, r)
+	}
+	// Save so that the computed hashes are reused next time.
+	if err := a.SaveProject(true); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func commandSimilar(a *App, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("similar", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	method := fs.String("method", PerceptualDCT, "perceptual hash method")
+	threshold := fs.Int("threshold", DefaultSimilarThreshold, "greatest Hamming distance")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 3 {
+		return nil, &UsageError{usageSimilar}
+	}
+	d, e, err := a.commandEntryTarget(fs.Arg(0), fs.Arg(1), fs.Arg(2))
+	if err != nil {
+		return nil, err
+	}
+	matches, err := a.FindSimilarEntries(d.UUID, e.Path, SimilarOptions{
+		Method:    *method,
+		Threshold: threshold,
+	})
+	if err != nil {
+		return nil, err
+	}
+	results := make([]CommandSimilar, 0)
+	for _, m := range matches {
+		d2, _ := a.Project.GetDirectoryByUUID(m.Directory)
+		results = append(results, CommandSimilar{
+			CommandEntry: commandEntry(d2, m.Entry),
+			Distance:     m.Distance,
+		})
+	}
+	return results, nil
+}
+
+func commandSheet(a *App, args []string) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, &UsageError{usageSheet}
+	}
+	fs := flag.NewFlagSet("sheet", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	sheet := &SpriteSheet{}
+	if args[0] == "grid" {
+		fs.IntVar(&sheet.Margin, "margin", 0, "space around the grid")
+		fs.IntVar(&sheet.Spacing, "spacing", 0, "space between cells")
+		fs.IntVar(&sheet.Columns, "columns", 0, "number of columns")
+		fs.IntVar(&sheet.Rows, "rows", 0, "number of rows")
+	}
+	if err := fs.Parse(args[1:]); err != nil || fs.NArg() < 3 {
+		return nil, &UsageError{usageSheet}
+	}
+	rest := fs.Args()[3:]
+	ints := func(s []string) ([]int, error) {
+		var values []int
+		for _, v := range s {
+			i, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, &UsageError{usageSheet}
+			}
+			values = append(values, i)
+		}
+		return values, nil
+	}
+
+	d, e, err := a.commandEntryTarget(fs.Arg(0), fs.Arg(1), fs.Arg(2))
+	if err != nil {
+		return nil, err
+	}
+	switch args[0] {
+	case "grid":
+		if len(rest) != 2 {
+			return nil, &UsageError{usageSheet}
+		}
+		size, err := ints(rest)
+		if err != nil {
+			return nil, err
+		}
+		sheet.CellWidth, sheet.CellHeight = size[0], size[1]
+	case "frame":
+		if len(rest) != 5 {
+			return nil, &UsageError{usageSheet}
+		}
+		rect, err := ints(rest[1:])
+		if err != nil {
+			return nil, err
+		}
+		// Add to or replace within the entry's existing frames.
+		if e.Sheet != nil {
+			sheet = e.Sheet.Clone()
+		}
+		frame := SpriteFrame{
+			Name:   rest[0],
+			X:      rect[0],
+			Y:      rect[1],
+			Width:  rect[2],
+			Height: rect[3],
+		}
+		replaced := false
+		for i, f := range sheet.Frames {
+			if f.Name == frame.Name {
+				sheet.Frames[i] = frame
+				replaced = true
+			}
+		}
+		if !replaced {
+			sheet.Frames = append(sheet.Frames, frame)
+		}
+	case "clear":
+		if len(rest) != 0 {
+			return nil, &UsageError{usageSheet}
+		}
+		sheet = nil
+	case "export":
+		if len(rest) != 1 {
+			return nil, &UsageError{usageSheet}
+		}
+		return a.ExportEntryFrames(d.UUID, e.Path, rest[0])
+	default:
+		return nil, &UsageError{usageSheet}
+	}
+
+	if err := a.SetEntrySpriteSheet(d.UUID, e.Path, sheet); err != nil {
+		return nil, err
+	}
+	if err := a.SaveProject(true); err != nil {
+		return nil, err
+	}
+	return commandEntry(d, e), nil
+}
+
+func commandAnimate(a *App, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("animate", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var opts AnimationOptions
+	fs.StringVar(&opts.Format, "format", "", "gif or apng")
+	fs.IntVar(&opts.FrameDuration, "duration", 100, "frame duration in milliseconds")
+	fs.IntVar(&opts.Loops, "loops", 0, "number of plays, or 0 to loop forever")
+	fs.IntVar(&opts.Scale.MaxWidth, "width", 0, "maximum frame width")
+	fs.IntVar(&opts.Scale.MaxHeight, "height", 0, "maximum frame height")
+	fs.StringVar(&opts.Scale.Method, "method", "", "scaling method")
+	if err := fs.Parse(args); err != nil || fs.NArg() < 4 {
+		return nil, &UsageError{usageAnimate}
+	}
+	if err := a.loadCommandProject(fs.Arg(0)); err != nil {
+		return nil, err
+	}
+	d, err := a.Project.FindDirectory(fs.Arg(1))
+	if err != nil {
+		return nil, err
+	}
+	output := fs.Arg(2)
+	if ext := strings.ToLower(filepath.Ext(output)); opts.Format == "" && (ext == ".apng" || ext == ".png") {
+		opts.Format = AnimationAPNG
+	}
+
+	var frames []AnimationFrame
+	for _, arg := range fs.Args()[3:] {
+		path, frame := arg, ""
+		if i := strings.LastIndexByte(arg, '#'); i != -1 {
+			path, frame = arg[:i], arg[i+1:]
+		}
+		frames = append(frames, AnimationFrame{
+			Directory: d.UUID,
+			Path:      filepath.FromSlash(path),
+			Frame:     frame,
+		})
+	}
+	if err := a.ExportAnimation(frames, opts, output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+func commandExport(a *App, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var opts ExportOptions
+	fs.StringVar(&opts.Mode, "mode", ExportCopy, "copy, hardlink, or symlink")
+	fs.BoolVar(&opts.Flatten, "flatten", false, "place every file directly in the destination")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "list what would be exported")
+	if err := fs.Parse(args); err != nil || fs.NArg() < 2 {
+		return nil, &UsageError{usageExport}
+	}
+	if err := a.loadCommandProject(fs.Arg(0)); err != nil {
+		return nil, err
+	}
+	return a.ExportQuery(strings.Join(fs.Args()[2:], " "), fs.Arg(1), opts)
+}
+
+func commandCatalog(a *App, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("catalog", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	format := fs.String("format", "", "json, csv, or sqlite")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 2 {
+		return nil, &UsageError{usageCatalog}
+	}
+	if err := a.loadCommandProject(fs.Arg(0)); err != nil {
+		return nil, err
+	}
+	output := fs.Arg(1)
+	if *format == "" {
+		switch strings.ToLower(filepath.Ext(output)) {
+		case ".csv":
+			*format = CatalogCSV
+		case ".db", ".sqlite", ".sqlite3":
+			*format = CatalogSQLite
+		default:
+			*format = CatalogJSON
+		}
+	}
+	if err := a.ExportCatalog(*format, output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+func commandImport(a *App, args []string) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, &UsageError{usageImport}
+	}
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	replace := fs.Bool("replace", false, "replace tags rather than merging them")
+	if err := fs.Parse(args[1:]); err != nil || fs.NArg() < 2 {
+		return nil, &UsageError{usageImport}
+	}
+	mode := ImportMerge
+	if *replace {
+		mode = ImportReplace
+	}
+	if err := a.loadCommandProject(fs.Arg(0)); err != nil {
+		return nil, err
+	}
+	d, err := a.Project.FindDirectory(fs.Arg(1))
+	if err != nil {
+		return nil, err
+	}
+
+	var report ImportReport
+	switch {
+	case args[0] == "csv" && fs.NArg() == 3:
+		report, err = a.ImportTagsCSV(d.UUID, fs.Arg(2), mode)
+	case args[0] == "captions" && fs.NArg() == 2:
+		report, err = a.ImportCaptions(d.UUID, mode)
+	default:
+		return nil, &UsageError{usageImport}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := a.SaveProject(true); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func commandXMP(a *App, args []string) (interface{}, error) {
+	if len(args) < 3 {
+		return nil, &UsageError{usageXMP}
+	}
+	if err := a.loadCommandProject(args[1]); err != nil {
+		return nil, err
+	}
+	d, err := a.Project.FindDirectory(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	var result interface{}
+	switch {
+	case args[0] == "mode" && len(args) == 4:
+		mode := args[3]
+		if mode == "off" {
+			mode = ""
+		}
+		if err := a.SetProjectDirectoryXMPSidecars(d.UUID, mode); err != nil {
+			return nil, err
+		}
+		result = args[3]
+	case args[0] == "sync" && len(args) == 3:
+		if result, err = a.SyncXMPSidecars(d.UUID); err != nil {
+			return nil, err
+		}
+	case args[0] == "resolve" && len(args) == 5 && (args[4] == "project" || args[4] == "sidecar"):
+		if err := a.ResolveXMPConflict(d.UUID, args[3], args[4] == "sidecar"); err != nil {
+			return nil, err
+		}
+		result = args[4]
+	default:
+		return nil, &UsageError{usageXMP}
+	}
+	if err := a.SaveProject(true); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func commandLinks(a *App, args []string) (interface{}, error) {
+	if len(args) != 3 || (args[2] != "follow" && args[2] != "skip") {
+		return nil, &UsageError{usageLinks}
+	}
+	if err := a.loadCommandProject(args[0]); err != nil {
+		return nil, err
+	}
+	d, err := a.Project.FindDirectory(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if err := a.SetProjectDirectoryFollowLinks(d.UUID, args[2] == "follow"); err != nil {
+		return nil, err
+	}
+	if err := a.SaveProject(true); err != nil {
+		return nil, err
+	}
+	return d.commandDirectory(), nil
+}
+
+// CommandIgnore is the result of the ignore command.
+type CommandIgnore struct {
+	Patterns []string
+	Dropped  []string `json:",omitempty"`
+}
+
+func commandIgnore(a *App, args []string) (interface{}, error) {
+	if len(args) < 3 {
+		return nil, &UsageError{usageIgnore}
+	}
+	if err := a.loadCommandProject(args[1]); err != nil {
+		return nil, err
+	}
+	d, err := a.Project.FindDirectory(args[2])
+	if err != nil {
+		return nil, err
+	}
+	patterns := args[3:]
+
+	switch {
+	case args[0] == "show" && len(args) == 3:
+		return CommandIgnore{Patterns: d.Ignore}, nil
+	case args[0] == "preview":
+		dropped, err := a.PreviewProjectDirectoryIgnore(d.UUID, patterns)
+		if err != nil {
+			return nil, err
+		}
+		return CommandIgnore{Patterns: patterns, Dropped: dropped}, nil
+	case args[0] == "set":
+		dropped, err := a.SetProjectDirectoryIgnore(d.UUID, patterns)
+		if err != nil {
+			return nil, err
+		}
+		if err := a.SaveProject(true); err != nil {
+			return nil, err
+		}
+		return CommandIgnore{Patterns: patterns, Dropped: dropped}, nil
+	}
+	return nil, &UsageError{usageIgnore}
+}
+
+// CommandInclude is the result of the include command.
+type CommandInclude struct {
+	Include  *IncludeFilter
+	Excluded []string `json:",omitempty"`
+}
+
+func commandInclude(a *App, args []string) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, &UsageError{usageInclude}
+	}
+	fs := flag.NewFlagSet("include", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	exts := fs.String("ext", "", "comma-separated extensions")
+	mimes := fs.String("mime", "", "comma-separated MIME globs")
+	var filter IncludeFilter
+	fs.Int64Var(&filter.MinSize, "min-size", 0, "smallest size in bytes")
+	fs.Int64Var(&filter.MaxSize, "max-size", 0, "largest size in bytes, or 0 for no limit")
+	if err := fs.Parse(args[1:]); err != nil || fs.NArg() != 2 {
+		return nil, &UsageError{usageInclude}
+	}
+	if err := a.loadCommandProject(fs.Arg(0)); err != nil {
+		return nil, err
+	}
+	d, err := a.Project.FindDirectory(fs.Arg(1))
+	if err != nil {
+		return nil, err
+	}
+	if *exts != "" {
+		filter.Extensions = strings.Split(*exts, ",")
+	}
+	if *mimes != "" {
+		filter.MIME = strings.Split(*mimes, ",")
+	}
+	// A filter without any criteria is the same as none.
+	include := &filter
+	if len(filter.Extensions) == 0 && len(filter.MIME) == 0 && filter.MinSize == 0 && filter.MaxSize == 0 {
+		include = nil
+	}
+
+	switch args[0] {
+	case "show":
+		return CommandInclude{Include: d.Include}, nil
+	case "preview":
+		excluded, err := a.PreviewProjectDirectoryInclude(d.UUID, include)
+		if err != nil {
+			return nil, err
+		}
+		return CommandInclude{Include: include, Excluded: excluded}, nil
+	case "set":
+		excluded, err := a.SetProjectDirectoryInclude(d.UUID, include)
+		if err != nil {
+			return nil, err
+		}
+		if err := a.SaveProject(true); err != nil {
+			return nil, err
+		}
+		return CommandInclude{Include: include, Excluded: excluded}, nil
+	}
+	return nil, &UsageError{usageInclude}
+}
+
+func commandRelocate(a *App, args []string) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, &UsageError{usageRelocate}
+	}
+	if err := a.loadCommandProject(args[0]); err != nil {
+		return nil, err
+	}
+	d, err := a.Project.FindDirectory(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if err := a.RelocateProjectDirectory(d.UUID, args[2]); err != nil {
+		return nil, err
+	}
+	if err := a.SaveProject(true); err != nil {
+		return nil, err
+	}
+	return d.commandDirectory(), nil
+}
+
+func commandRelative(a *App, args []string) (interface{}, error) {
+	if len(args) != 3 || (args[2] != "on" && args[2] != "off") {
+		return nil, &UsageError{usageRelative}
+	}
+	if err := a.loadCommandProject(args[0]); err != nil {
+		return nil, err
+	}
+	d, err := a.Project.FindDirectory(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if err := a.SetProjectDirectoryRelative(d.UUID, args[2] == "on"); err != nil {
+		return nil, err
+	}
+	if err := a.SaveProject(true); err != nil {
+		return nil, err
+	}
+	return d.commandDirectory(), nil
+}
+
+func commandSave(a *App, args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, &UsageError{usageSave}
+	}
+	if err := a.loadCommandProject(args[0]); err != nil {
+		return nil, err
+	}
+	if err := a.SaveProject(true); err != nil {
+		return nil, err
+	}
+	return a.Project.commandProject(), nil
+}
+
+// CommandUsage returns the usage of every command.
+func CommandUsage() []string {
+	var names []string
+	for name := range Commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var usages []string
+	for _, name := range names {
+		usages = append(usages, "treesource "+Commands[name].Usage)
+	}
+	return usages
+}
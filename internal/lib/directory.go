@@ -1,8 +1,15 @@
 package lib
 
 import (
+	"context"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -16,6 +23,19 @@ type Directory struct {
 	Entries    []*DirectoryEntry `json:"Entries" yaml:"Entries"`
 	IgnoreDot  bool              `json:"IgnoreDot" yaml:"IgnoreDot"`
 	SyncOnLoad bool              `json:"SyncOnLoad" yaml:"SyncOnLoad"`
+	Watch      bool              `json:"Watch" yaml:"Watch,omitempty"` // Watch represents if the directory should be watched for changes while the project is open.
+	// XMPSidecars is how entries are synced with their .xmp sidecar files: read, write, both, or empty to not use sidecars.
+	XMPSidecars string `json:"XMPSidecars" yaml:"XMPSidecars,omitempty"`
+	// Ignore holds patterns of .gitignore syntax, relative to Path, of files to leave out of the directory. IgnoreFile files within the directory add their own patterns.
+	Ignore []string `json:"Ignore" yaml:"Ignore,omitempty"`
+	// Include limits which files become new entries. If nil, every file that is not ignored does.
+	Include *IncludeFilter `json:"Include" yaml:"Include,omitempty"`
+	// FollowLinks is if symlinked directories are synced as part of the directory. Symlinked files are always synced.
+	FollowLinks bool `json:"FollowLinks" yaml:"FollowLinks,omitempty"`
+	// Relative represents if Path is saved relative to the project file, so that the project can be moved along with its sources. Path itself is always absolute once loaded.
+	Relative bool `json:"Relative" yaml:"Relative,omitempty"`
+	// index maps entry paths to the entries of Entries. It is built when the directory is loaded or cloned and kept in step by Add, Insert, Remove, and rename, so that looking up an entry never writes to it.
+	index map[string]*DirectoryEntry
 }
 
 func (d *Directory) Clone() *Directory {
@@ -25,18 +45,36 @@ func (d *Directory) Clone() *Directory {
 	d2.Separator = string(os.PathSeparator)
 	d2.IgnoreDot = d.IgnoreDot
 	d2.SyncOnLoad = d.SyncOnLoad
+	d2.Watch = d.Watch
+	d2.XMPSidecars = d.XMPSidecars
+	d2.Ignore = append([]string(nil), d.Ignore...)
+	d2.Include = d.Include.Clone()
+	d2.FollowLinks = d.FollowLinks
+	d2.Relative = d.Relative
 	d2.Emitter = *NewEmitter()
 
 	for _, e := range d.Entries {
 		e2 := e.Clone()
 		d2.Entries = append(d2.Entries, &e2)
 	}
+	d2.reindex()
 
 	return d2
 }
 
-// Entry retrieves an entry matching the given name.
+// reindex rebuilds the path index from Entries.
+func (d *Directory) reindex() {
+	d.index = make(map[string]*DirectoryEntry, len(d.Entries))
+	for _, e := range d.Entries {
+		d.index[e.Path] = e
+	}
+}
+
+// Entry retrieves an entry matching the given name. Entries are searched directly if the directory has not been indexed.
 func (d *Directory) Entry(name string) *DirectoryEntry {
+	if d.index != nil {
+		return d.index[name]
+	}
 	for _, e := range d.Entries {
 		if e.Path == name {
 			return e
@@ -45,17 +83,64 @@ func (d *Directory) Entry(name string) *DirectoryEntry {
 	return nil
 }
 
+// Add appends an entry.
+func (d *Directory) Add(e *DirectoryEntry) {
+	if d.index == nil {
+		d.reindex()
+	}
+	d.Entries = append(d.Entries, e)
+	d.index[e.Path] = e
+}
+
+// Insert inserts an entry at the given index.
+func (d *Directory) Insert(i int, e *DirectoryEntry) {
+	if d.index == nil {
+		d.reindex()
+	}
+	d.Entries = append(d.Entries, nil)
+	copy(d.Entries[i+1:], d.Entries[i:])
+	d.Entries[i] = e
+	d.index[e.Path] = e
+}
+
 // Remove removes an entry matching the given name and returns it and its index.
 func (d *Directory) Remove(name string) (*DirectoryEntry, int) {
-	for i, e := range d.Entries {
-		if e.Path == name {
+	e := d.Entry(name)
+	if e == nil {
+		return nil, -1
+	}
+	for i, e2 := range d.Entries {
+		if e2 == e {
 			d.Entries = append(d.Entries[:i], d.Entries[i+1:]...)
+			delete(d.index, name)
 			return e, i
 		}
 	}
 	return nil, -1
 }
 
+// subsume subsumes o into the given entry, keeping the index in step should its path change.
+func (d *Directory) subsume(e *DirectoryEntry, o DirectoryEntry) {
+	path := e.Path
+	e.Subsume(o)
+	if e.Path != path {
+		e.Path = path
+		d.rename(e, o.Path)
+	}
+}
+
+// rename moves the given entry to a new path, keeping the index in step.
+func (d *Directory) rename(e *DirectoryEntry, path string) {
+	if d.index == nil {
+		d.reindex()
+	}
+	if d.index[e.Path] == e {
+		delete(d.index, e.Path)
+	}
+	e.Path = path
+	d.index[path] = e
+}
+
 func (d *Directory) EmitAllEntries() {
 	for _, e := range d.Entries {
 		d.Emit("entry", &DirectoryEntryEvent{
@@ -65,76 +150,200 @@ func (d *Directory) EmitAllEntries() {
 	}
 }
 
-// SyncEntries synchronizes the directory's entries with the on-disk file structure. Emits: sync, synced, add, found, missing
+// SyncWorkers is the number of goroutines that read a directory's subdirectories during a sync.
+var SyncWorkers = runtime.NumCPU()
+
+// SyncEntries synchronizes the directory's entries with the on-disk file structure. Emits: sync, progress, synced, add, move, change, found, missing
 func (d *Directory) SyncEntries() error {
-	d.Emit("sync", &DirectorySyncEvent{
-		UUID: d.UUID,
-	})
-	unmatchedEntries := make([]*DirectoryEntry, len(d.Entries))
-	copy(unmatchedEntries, d.Entries)
-	var errors []error
-	var walk func(local, name string)
-	walk = func(local, name string) {
-		entries, err := os.ReadDir(name)
-		if err != nil {
-			errors = append(errors, err)
-			return
+	return d.SyncEntriesContext(context.Background())
+}
+
+// SyncEntriesContext synchronizes the directory's entries with the on-disk file structure, reading subdirectories in parallel. If ctx is canceled, the sync stops without adding or marking anything as missing. Emits: sync, progress, synced, add, move, change, found, missing
+func (d *Directory) SyncEntriesContext(ctx context.Context) error {
+	scan, err := d.settings().scanEntries(ctx, d.knownEntries())
+	if err != nil {
+		return err
+	}
+	return d.applyScan(scan)
+}
+
+// settings returns a copy of the directory without its entries, sharing its event handlers, for reading its file structure without holding the project lock.
+func (d *Directory) settings() *Directory {
+	return &Directory{
+		Emitter:     d.Emitter,
+		UUID:        d.UUID,
+		Path:        d.Path,
+		Separator:   d.Separator,
+		IgnoreDot:   d.IgnoreDot,
+		Ignore:      append([]string(nil), d.Ignore...),
+		Include:     d.Include.Clone(),
+		FollowLinks: d.FollowLinks,
+	}
+}
+
+// knownEntry is what an entry last saw of its file, copied out of the directory so that files can be hashed without holding the project lock.
+type knownEntry struct {
+	size    int64
+	modTime time.Time
+	hash    string
+	tracked bool // tracked is if the entry has tags or a rating worth following should it be moved.
+}
+
+// knownEntries returns what each of the directory's entries last saw of its file, by path.
+func (d *Directory) knownEntries() map[string]knownEntry {
+	known := make(map[string]knownEntry, len(d.Entries))
+	for _, e := range d.Entries {
+		known[e.Path] = knownEntry{
+			size:    e.Size,
+			modTime: e.ModTime,
+			hash:    e.Hash,
+			tracked: len(e.Tags) > 0 || e.Rating != 0,
+		}
+	}
+	return known
+}
+
+// hashFiles hashes the scanned files whose hashes will be needed once they are applied, returning them by path. Those are the files of tracked entries without a hash or that have changed, and new files of the same size as a hashed entry among lost, as they may have been moved from it. Entries of lost that were found are skipped. Hashing stops early if ctx is canceled.
+func (d *Directory) hashFiles(ctx context.Context, files []scannedFile, known map[string]knownEntry, lost []string) map[string]string {
+	found := make(map[string]struct{}, len(files))
+	for _, f := range files {
+		found[f.local] = struct{}{}
+	}
+	sizes := make(map[int64]struct{})
+	for _, local := range lost {
+		if _, ok := found[local]; ok {
+			continue
 		}
-		for _, e := range entries {
-			fullpath := filepath.Join(name, e.Name())
-			localpath := filepath.Join(local, e.Name())
-			if d.IgnoreDot && e.Name()[0] == '.' {
+		if k := known[local]; k.hash != "" && !k.modTime.IsZero() {
+			sizes[k.size] = struct{}{}
+		}
+	}
+
+	hashes := make(map[string]string)
+	for _, f := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		k, ok := known[f.local]
+		if ok {
+			changed := k.size != f.info.Size() || !k.modTime.Equal(f.info.ModTime())
+			if !k.tracked || (k.hash != "" && !changed) {
 				continue
 			}
-			if e.IsDir() {
-				walk(localpath, fullpath)
-			} else {
-				if d.Entry(localpath) == nil {
-					d.Entries = append(d.Entries, &DirectoryEntry{
-						Path: localpath,
-					})
-					d.Emit("add", &DirectoryEntryAddEvent{
-						UUID:  d.UUID,
-						Entry: d.Entries[len(d.Entries)-1],
-					})
-				} else {
-					for i, e := range unmatchedEntries {
-						if e.Path == localpath {
-							//unmatchedEntries = slices.Delete(unmatchedEntries, i, i+1)
-							unmatchedEntries[i] = unmatchedEntries[len(unmatchedEntries)-1]
-							unmatchedEntries = unmatchedEntries[:len(unmatchedEntries)-1]
-							// Mark found entries as not missing if they were marked as such.
-							if e.Missing {
-								e.Missing = false
-								d.Emit("found", &DirectoryEntryFoundEvent{
-									UUID:  d.UUID,
-									Entry: e,
-								})
-							}
-							break
-						}
-					}
-				}
-			}
+		} else if _, ok := sizes[f.info.Size()]; !ok {
+			continue
+		}
+		if hash, err := HashFile(filepath.Join(d.Path, f.local)); err == nil {
+			hashes[f.local] = hash
 		}
 	}
+	return hashes
+}
+
+// directoryScan is the file structure read by scanEntries, waiting to be applied to the entries of its directory.
+type directoryScan struct {
+	files    []scannedFile
+	errors   []error
+	ignores  *ignoreCache
+	hashes   map[string]string // hashes are those of the files that applying the scan needs, by path.
+	progress DirectorySyncProgressEvent
+	last     time.Time // last is when progress was last emitted.
+}
 
-	walk("", d.Path)
+// scanEntries reads the directory's file structure and hashes the files that need it, given what its entries last saw of them. Only its settings are read, so it may be called on the copy returned by settings. If ctx is canceled, synced is emitted with the error and the error is returned. Emits: sync, progress, synced
+func (d *Directory) scanEntries(ctx context.Context, known map[string]knownEntry) (*directoryScan, error) {
+	d.Emit("sync", &DirectorySyncEvent{
+		UUID: d.UUID,
+	})
 
-	// Mark any unmatched entries as missing.
-	for _, e := range unmatchedEntries {
-		for i, e2 := range d.Entries {
-			if e.Path == e2.Path {
-				d.Entries[i].Missing = true
-				d.Emit("missing", &DirectoryEntryMissingEvent{
+	scan := &directoryScan{
+		ignores: newIgnoreCache(d.Path, d.Ignore),
+		progress: DirectorySyncProgressEvent{
+			UUID: d.UUID,
+		},
+		last: time.Now(),
+	}
+	scan.files, scan.errors = d.scan(ctx, d.scanStart(""), scan.ignores, func(dirs, files int) {
+		scan.progress.Directories, scan.progress.Files = dirs, files
+		if time.Since(scan.last) > 250*time.Millisecond {
+			scan.last = time.Now()
+			d.emitProgress(scan.progress)
+		}
+	})
+	lost := make([]string, 0, len(known))
+	for local := range known {
+		lost = append(lost, local)
+	}
+	scan.hashes = d.hashFiles(ctx, scan.files, known, lost)
+	if err := ctx.Err(); err != nil {
+		d.Emit("synced", &DirectorySyncedEvent{
+			UUID:  d.UUID,
+			Error: err,
+		})
+		return nil, err
+	}
+	return scan, nil
+}
+
+// emitProgress emits a copy of the given progress, as handlers may hold onto it.
+func (d *Directory) emitProgress(progress DirectorySyncProgressEvent) {
+	d.Emit("progress", &progress)
+}
+
+// applyScan applies a scan of the directory's file structure to its entries. When the directory belongs to a project, the project's write lock must be held. Emits: progress, synced, add, move, change, found, missing
+func (d *Directory) applyScan(scan *directoryScan) error {
+	files, errors, progress := scan.files, scan.errors, scan.progress
+
+	unmatched := make(map[*DirectoryEntry]struct{}, len(d.Entries))
+	for _, e := range d.Entries {
+		unmatched[e] = struct{}{}
+	}
+	var added []*DirectoryEntry
+	for _, f := range files {
+		if e := d.Entry(f.local); e == nil {
+			if !d.Include.Matches(f.local, f.info.Size()) {
+				continue
+			}
+			entry := &DirectoryEntry{
+				Path:   f.local,
+				Linked: f.linked,
+			}
+			entry.stat(f.info)
+			entry.Hash = scan.hashes[f.local]
+			added = append(added, entry)
+		} else if _, ok := unmatched[e]; ok {
+			delete(unmatched, e)
+			e.Linked = f.linked
+			d.statEntry(e, f.info, scan.hashes[f.local])
+			// Mark found entries as not missing if they were marked as such.
+			if e.Missing {
+				e.Missing = false
+				d.Emit("found", &DirectoryEntryFoundEvent{
 					UUID:  d.UUID,
 					Entry: e,
 				})
-				break
 			}
 		}
 	}
 
+	// Keep the unmatched entries in their stored order. Entries that became ignored were not looked for, so they are marked missing along with the rest, keeping their tags until SetDirectoryIgnore drops them.
+	var lost []*DirectoryEntry
+	for _, e := range d.Entries {
+		if _, ok := unmatched[e]; ok {
+			lost = append(lost, e)
+		}
+	}
+
+	// Add new entries and mark any unmatched entries as missing, unless they were moved. Progress keeps being reported as they are, as hashing candidates for moves can take a while.
+	progress.Added, progress.Missing = d.applyChanges(added, lost, func(adds, missing int) {
+		progress.Added, progress.Missing = adds, missing
+		if time.Since(scan.last) > 250*time.Millisecond {
+			scan.last = time.Now()
+			d.emitProgress(progress)
+		}
+	})
+	d.emitProgress(progress)
+
 	var err error
 	if len(errors) > 0 {
 		err = &SyncError{errors}
@@ -147,6 +356,475 @@ func (d *Directory) SyncEntries() error {
 	return err
 }
 
+// scannedFile is a file found while scanning a directory.
+type scannedFile struct {
+	local  string
+	info   fs.FileInfo
+	linked bool
+}
+
+// scannedDir is the result of reading a single directory while scanning.
+type scannedDir struct {
+	files  []scannedFile
+	errors []error
+}
+
+// fileID identifies a file or directory regardless of the path it is reached by.
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// scanItem is a directory waiting to be read while scanning.
+type scanItem struct {
+	local string
+	// linked is if the directory was reached through a symlink.
+	linked bool
+	// ids holds the identities of the directory and those above it, used to stop at symlinks that loop back up. It is only kept when following links.
+	ids []fileID
+}
+
+// scanStart returns the scan item of the given path, relative to the directory's path, finding if it is reached through a symlink and, if following links, the identities of it and the directories above it.
+func (d *Directory) scanStart(local string) scanItem {
+	return newScanItem(d.Path, local, d.FollowLinks)
+}
+
+func newScanItem(root string, local string, followLinks bool) scanItem {
+	item := scanItem{
+		local: local,
+	}
+	var parts []string
+	if local != "" {
+		parts = strings.Split(local, string(os.PathSeparator))
+	}
+	for i := 0; i <= len(parts); i++ {
+		name := filepath.Join(root, filepath.Join(parts[:i]...))
+		if i > 0 {
+			if info, err := os.Lstat(name); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+				item.linked = true
+			}
+		}
+		if followLinks {
+			if info, err := os.Stat(name); err == nil {
+				if id, ok := getFileID(name, info); ok {
+					item.ids = append(item.ids, id)
+				}
+			}
+		}
+	}
+	return item
+}
+
+// scan reads the file structure beneath the given item using SyncWorkers goroutines, returning every file not ignored in the order of a depth-first walk. progress is called with the number of directories read and files found so far.
+func (d *Directory) scan(ctx context.Context, start scanItem, ignores *ignoreCache, progress func(dirs, files int)) ([]scannedFile, []error) {
+	var (
+		mutex  sync.Mutex
+		cond   = sync.NewCond(&mutex)
+		queue  = []scanItem{start}
+		active int
+		wg     sync.WaitGroup
+	)
+	results := make(chan scannedDir, SyncWorkers)
+
+	workers := SyncWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				mutex.Lock()
+				for len(queue) == 0 && active > 0 {
+					cond.Wait()
+				}
+				// Stop once nothing is left to read, dropping what is left if canceled.
+				if len(queue) == 0 || ctx.Err() != nil {
+					queue = nil
+					cond.Broadcast()
+					mutex.Unlock()
+					return
+				}
+				item := queue[len(queue)-1]
+				queue = queue[:len(queue)-1]
+				active++
+				mutex.Unlock()
+
+				result, subdirs := d.scanDir(item, ignores)
+				results <- result
+
+				mutex.Lock()
+				active--
+				queue = append(queue, subdirs...)
+				cond.Broadcast()
+				mutex.Unlock()
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var files []scannedFile
+	var errors []error
+	dirs := 0
+	for r := range results {
+		dirs++
+		files = append(files, r.files...)
+		errors = append(errors, r.errors...)
+		progress(dirs, len(files))
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return lessLocalPath(files[i].local, files[j].local)
+	})
+	return files, errors
+}
+
+// scanDir reads a single directory, returning its files and subdirectories that are not ignored. Symlinked files are read through to their targets, while symlinked directories are only returned if following links and they do not loop back up to a directory above them. Broken links are returned as errors.
+func (d *Directory) scanDir(item scanItem, ignores *ignoreCache) (scannedDir, []scanItem) {
+	var result scannedDir
+	var subdirs []scanItem
+	entries, err := os.ReadDir(filepath.Join(d.Path, item.local))
+	if err != nil {
+		result.errors = append(result.errors, err)
+		return result, nil
+	}
+	for _, e := range entries {
+		localpath := filepath.Join(item.local, e.Name())
+		if d.IgnoreDot && e.Name()[0] == '.' {
+			continue
+		}
+		linked := item.linked
+		var info fs.FileInfo
+		if e.Type()&fs.ModeSymlink != 0 {
+			linked = true
+			info, err = os.Stat(filepath.Join(d.Path, localpath))
+			if err != nil {
+				target, _ := os.Readlink(filepath.Join(d.Path, localpath))
+				result.errors = append(result.errors, &BrokenLinkError{localpath, target})
+				continue
+			}
+			if info.IsDir() && !d.FollowLinks {
+				continue
+			}
+		} else if info, err = e.Info(); err != nil {
+			result.errors = append(result.errors, err)
+			continue
+		}
+		if ignores.ignoredIn(item.local, localpath, info.IsDir()) {
+			continue
+		}
+		if info.IsDir() {
+			subdir := scanItem{
+				local:  localpath,
+				linked: linked,
+			}
+			if d.FollowLinks {
+				if id, ok := getFileID(filepath.Join(d.Path, localpath), info); ok {
+					if containsFileID(item.ids, id) {
+						continue
+					}
+					subdir.ids = append(append([]fileID(nil), item.ids...), id)
+				}
+			}
+			subdirs = append(subdirs, subdir)
+			continue
+		}
+		result.files = append(result.files, scannedFile{
+			local:  localpath,
+			info:   info,
+			linked: linked,
+		})
+	}
+	return result, subdirs
+}
+
+func containsFileID(ids []fileID, id fileID) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// lessLocalPath orders paths as a depth-first walk of sorted directories would visit them, which is by their components.
+func lessLocalPath(a, b string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] == os.PathSeparator {
+				return true
+			}
+			if b[i] == os.PathSeparator {
+				return false
+			}
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// SyncPaths synchronizes only the given paths, relative to the directory, with the on-disk file structure. Paths that are directories are synchronized along with everything beneath them. Ignored paths are skipped. Emits: add, move, change, found, missing
+func (d *Directory) SyncPaths(paths []string) {
+	d.applyPaths(d.settings().scanPaths(paths, d.knownEntries()))
+}
+
+// scannedPath is a path read by scanPaths.
+type scannedPath struct {
+	local string
+	gone  bool // gone is if nothing exists at the path anymore.
+	dir   bool // dir is if the path is a directory, in which case files are every file beneath it.
+	files []scannedFile
+}
+
+// pathScan is the state of the paths read by scanPaths, waiting to be applied to the entries of its directory.
+type pathScan struct {
+	paths   []scannedPath
+	ignores *ignoreCache
+	hashes  map[string]string // hashes are those of the files that applying the scan needs, by path.
+}
+
+// scanPaths reads the given paths and hashes the files that need it, given what the directory's entries last saw of them. As with scanEntries, only the directory's settings are read. Ignored paths are left out.
+func (d *Directory) scanPaths(paths []string, known map[string]knownEntry) *pathScan {
+	scan := &pathScan{
+		ignores: newIgnoreCache(d.Path, d.Ignore),
+	}
+	var files []scannedFile
+	var lost []string
+	beneath := func(local string) {
+		for p := range known {
+			if p == local || strings.HasPrefix(p, local+d.Separator) {
+				lost = append(lost, p)
+			}
+		}
+	}
+	for _, local := range paths {
+		info, err := os.Stat(filepath.Join(d.Path, local))
+		if err != nil {
+			scan.paths = append(scan.paths, scannedPath{
+				local: local,
+				gone:  true,
+			})
+			beneath(local)
+			continue
+		}
+		// Ignored paths are missing, as a full sync would not find them.
+		if scan.ignores.Ignored(local, info.IsDir()) {
+			scan.paths = append(scan.paths, scannedPath{
+				local: local,
+				gone:  true,
+			})
+			beneath(local)
+			continue
+		}
+		start := d.scanStart(local)
+		if !info.IsDir() {
+			f := scannedFile{
+				local:  local,
+				info:   info,
+				linked: start.linked,
+			}
+			scan.paths = append(scan.paths, scannedPath{
+				local: local,
+				files: []scannedFile{f},
+			})
+			files = append(files, f)
+			continue
+		}
+		if (start.linked && !d.FollowLinks) || (d.IgnoreDot && filepath.Base(local)[0] == '.') {
+			continue
+		}
+		dirFiles, _ := d.scan(context.Background(), start, scan.ignores, func(dirs, files int) {})
+		scan.paths = append(scan.paths, scannedPath{
+			local: local,
+			dir:   true,
+			files: dirFiles,
+		})
+		files = append(files, dirFiles...)
+		beneath(local)
+	}
+	scan.hashes = d.hashFiles(context.Background(), files, known, lost)
+	return scan
+}
+
+// applyPaths applies a scan of some of the directory's paths to its entries. When the directory belongs to a project, the project's write lock must be held. Emits: add, move, change, found, missing
+func (d *Directory) applyPaths(scan *pathScan) {
+	var added, lost []*DirectoryEntry
+	seen := make(map[string]bool)
+	lose := func(local string) {
+		if e := d.Entry(local); e != nil && !e.Missing {
+			lost = append(lost, e)
+		}
+	}
+	find := func(f scannedFile) {
+		if seen[f.local] {
+			return
+		}
+		seen[f.local] = true
+		if e := d.Entry(f.local); e == nil {
+			if !d.Include.Matches(f.local, f.info.Size()) {
+				return
+			}
+			entry := &DirectoryEntry{
+				Path:   f.local,
+				Linked: f.linked,
+			}
+			entry.stat(f.info)
+			entry.Hash = scan.hashes[f.local]
+			added = append(added, entry)
+		} else {
+			e.Linked = f.linked
+			d.statEntry(e, f.info, scan.hashes[f.local])
+			if e.Missing {
+				e.Missing = false
+				d.Emit("found", &DirectoryEntryFoundEvent{
+					UUID:  d.UUID,
+					Entry: e,
+				})
+			}
+		}
+	}
+
+	for _, p := range scan.paths {
+		switch {
+		case p.gone:
+			// The path is gone, so anything at or beneath it is missing.
+			lose(p.local)
+			for _, e := range d.Entries {
+				if strings.HasPrefix(e.Path, p.local+d.Separator) {
+					lose(e.Path)
+				}
+			}
+		case !p.dir:
+			find(p.files[0])
+		default:
+			// The path is a directory, so check what it currently contains against what we know of it.
+			unmatched := make(map[string]struct{})
+			for _, e := range d.Entries {
+				if strings.HasPrefix(e.Path, p.local+d.Separator) {
+					unmatched[e.Path] = struct{}{}
+				}
+			}
+			for _, f := range p.files {
+				delete(unmatched, f.local)
+				find(f)
+			}
+			for local := range unmatched {
+				lose(local)
+			}
+		}
+	}
+
+	d.applyChanges(added, lost, nil)
+}
+
+// applyChanges adds the given new entries and marks the given lost entries as missing, returning how many were added and how many are missing. If a new entry appears to be a lost entry that was moved or renamed, the lost entry is moved to the new path instead, keeping its tags and rating. If progress is not nil, it is called with the counts so far after each entry is added or marked as missing. Emits: add, move, missing
+func (d *Directory) applyChanges(added []*DirectoryEntry, lost []*DirectoryEntry, progress func(adds, missing int)) (adds int, missing int) {
+	// Only entries of the same size can be the source of a move.
+	bySize := make(map[int64][]*DirectoryEntry)
+	for _, e := range lost {
+		bySize[e.Size] = append(bySize[e.Size], e)
+	}
+	moved := make(map[*DirectoryEntry]bool)
+
+	for _, e := range added {
+		candidates := bySize[e.Size]
+		if i := d.findMoveSource(e, candidates); i != -1 {
+			from := candidates[i]
+			bySize[e.Size] = append(candidates[:i], candidates[i+1:]...)
+			moved[from] = true
+			previous := from.Path
+			d.rename(from, e.Path)
+			from.Size = e.Size
+			from.ModTime = e.ModTime
+			if e.Hash != "" {
+				from.Hash = e.Hash
+			}
+			from.Missing = false
+			from.Linked = e.Linked
+			d.Emit("move", &DirectoryEntryMoveEvent{
+				UUID:  d.UUID,
+				From:  previous,
+				Entry: from,
+			})
+			continue
+		}
+		d.Add(e)
+		adds++
+		d.Emit("add", &DirectoryEntryAddEvent{
+			UUID:  d.UUID,
+			Entry: e,
+		})
+		if progress != nil {
+			progress(adds, missing)
+		}
+	}
+
+	for _, e := range lost {
+		if moved[e] {
+			continue
+		}
+		e.Missing = true
+		missing++
+		d.Emit("missing", &DirectoryEntryMissingEvent{
+			UUID:  d.UUID,
+			Entry: e,
+		})
+		if progress != nil {
+			progress(adds, missing)
+		}
+	}
+	return adds, missing
+}
+
+// findMoveSource returns the index of the lost entry that the given new entry was moved from, or -1 if there is none. Entries with a known content hash are matched by the new entry's hash, which is computed while scanning, otherwise exactly one entry with the same size and modification time is required.
+func (d *Directory) findMoveSource(e *DirectoryEntry, lost []*DirectoryEntry) int {
+	hashed, timed := -1, -1
+	timedCount := 0
+	for i, l := range lost {
+		if l.Size != e.Size || l.ModTime.IsZero() {
+			continue
+		}
+		if l.Hash != "" {
+			if l.Hash != e.Hash {
+				continue
+			}
+			// Prefer a file that kept its name but changed folders.
+			if hashed == -1 || filepath.Base(l.Path) == filepath.Base(e.Path) {
+				hashed = i
+			}
+		} else if l.ModTime.Equal(e.ModTime) {
+			timed = i
+			timedCount++
+		}
+	}
+	if hashed != -1 {
+		return hashed
+	}
+	if timedCount == 1 {
+		return timed
+	}
+	return -1
+}
+
+// statEntry records the file info of an existing entry, along with the hash of its file if one was computed while scanning. Emits: change
+func (d *Directory) statEntry(e *DirectoryEntry, info fs.FileInfo, hash string) {
+	// Entries that were never stat'd have nothing to compare against.
+	known := !e.ModTime.IsZero()
+	if e.stat(info) && known {
+		d.Emit("change", &DirectoryEntryChangeEvent{
+			UUID:  d.UUID,
+			Entry: e,
+		})
+	}
+	if e.Hash == "" {
+		e.Hash = hash
+	}
+}
+
 // DirectoryEntry represents an entry in a treesource directory.
 type DirectoryEntry struct {
 	// Path is relative to the owning Directory's path.
@@ -155,19 +833,47 @@ type DirectoryEntry struct {
 	Rating float64  `json:"Rating" yaml:"Rating,omitempty"`
 	// Missing represents if the entry is referring to a file that no longer exists.
 	Missing bool `json:"Missing,omitempty" yaml:"Missing,omitempty"`
+	// Size, ModTime, and Hash are what was last seen of the file, used to follow it if it is moved or renamed.
+	Size    int64     `json:"Size,omitempty" yaml:"Size,omitempty"`
+	ModTime time.Time `json:"ModTime" yaml:"ModTime,omitempty"`
+	Hash    string    `json:"Hash,omitempty" yaml:"Hash,omitempty"`
+	// Sheet divides an image entry into frames.
+	Sheet *SpriteSheet `json:"Sheet,omitempty" yaml:"Sheet,omitempty"`
+	// XMP is the tags and rating last synced with the entry's XMP sidecar, used to tell which side has since changed.
+	XMP *XMPState `json:"XMP,omitempty" yaml:"XMP,omitempty"`
+	// Linked represents if the entry's file is reached through a symlink, either of itself or of a directory above it.
+	Linked bool `json:"Linked,omitempty" yaml:"Linked,omitempty"`
 }
 
 func (e *DirectoryEntry) Clone() (e2 DirectoryEntry) {
 	e2.Path = e.Path
-	copy(e2.Tags, e.Tags)
+	e2.Tags = append([]string(nil), e.Tags...)
 	e2.Rating = e.Rating
 	e2.Missing = e.Missing
+	e2.Size = e.Size
+	e2.ModTime = e.ModTime
+	e2.Hash = e.Hash
+	e2.Sheet = e.Sheet.Clone()
+	e2.XMP = e.XMP.Clone()
+	e2.Linked = e.Linked
 	return
 }
 
+// stat records the file info of the entry, returning if its size or modification time changed.
+func (e *DirectoryEntry) stat(info fs.FileInfo) bool {
+	changed := e.Size != info.Size() || !e.ModTime.Equal(info.ModTime())
+	if changed {
+		e.Hash = ""
+	}
+	e.Size = info.Size()
+	e.ModTime = info.ModTime()
+	return changed
+}
+
 func (e *DirectoryEntry) Subsume(o DirectoryEntry) {
 	e.Path = o.Path
 	e.Tags = o.Tags
 	e.Rating = o.Rating
 	e.Missing = o.Missing
+	e.Sheet = o.Sheet.Clone()
 }
@@ -0,0 +1,85 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// benchmarkDirectory returns a synced directory of n files spread across subdirectories of 100 files each.
+func benchmarkDirectory(b *testing.B, n int) *Directory {
+	b.Helper()
+	root := b.TempDir()
+	for i := 0; i < n; i++ {
+		dir := filepath.Join(root, fmt.Sprintf("%03d", i/100))
+		if i%100 == 0 {
+			if err := os.Mkdir(dir, 0755); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%05d.png", i)), nil, 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	d := &Directory{
+		Emitter: *NewEmitter(),
+		UUID:    uuid.New(),
+		Path:    root,
+	}
+	if err := d.SyncEntries(); err != nil {
+		b.Fatal(err)
+	}
+	if len(d.Entries) != n {
+		b.Fatalf("synced %d entries, expected %d", len(d.Entries), n)
+	}
+	return d
+}
+
+func BenchmarkDirectoryEntry(b *testing.B) {
+	for _, n := range []int{1000, 10000, 100000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			d := &Directory{}
+			for i := 0; i < n; i++ {
+				d.Add(&DirectoryEntry{Path: fmt.Sprintf("%05d.png", i)})
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if d.Entry(fmt.Sprintf("%05d.png", n-1-i%n)) == nil {
+					b.Fatal("missing entry")
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkSyncEntries(b *testing.B) {
+	for _, n := range []int{1000, 10000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			d := benchmarkDirectory(b, n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := d.SyncEntries(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGetDirectoryByUUID(b *testing.B) {
+	p := NewProject()
+	for i := 0; i < 100; i++ {
+		p.Directories = append(p.Directories, Directory{UUID: uuid.New()})
+	}
+	p.reindex()
+	u := p.Directories[len(p.Directories)-1].UUID
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.GetDirectoryByUUID(u); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
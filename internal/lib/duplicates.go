@@ -0,0 +1,188 @@
+package lib
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EntryRef refers to an entry within a directory.
+type EntryRef struct {
+	Directory uuid.UUID `json:"Directory"`
+	Path      string    `json:"Path"`
+}
+
+// DuplicateGroup is a set of entries whose files are byte-identical.
+type DuplicateGroup struct {
+	Hash    string       `json:"Hash"`
+	Size    int64        `json:"Size"`
+	Entries []QueryMatch `json:"Entries"`
+}
+
+// duplicateCandidate is a copy of an entry considered by FindDuplicates, so that its file can be stat'd and hashed without holding the lock.
+type duplicateCandidate struct {
+	dir     uuid.UUID
+	name    string // name is the full path of the entry's file.
+	path    string
+	size    int64
+	modTime time.Time
+	hash    string
+	info    fs.FileInfo
+}
+
+// FindDuplicates hashes every entry that is not missing and returns groups of byte-identical files across all directories. Only files that share a size with another file are hashed, and hashes are reused from entries whose size and modification time have not changed. Files are read without holding the lock, and entries that changed in the meantime are left out. The grouped entries are copies. Emits: duplicates-progress, directory-entry-change
+func (p *Project) FindDuplicates() []DuplicateGroup {
+	var candidates []*duplicateCandidate
+	p.mutex.RLock()
+	for i := range p.Directories {
+		d := &p.Directories[i]
+		for _, e := range d.Entries {
+			if e.Missing {
+				continue
+			}
+			candidates = append(candidates, &duplicateCandidate{
+				dir:     d.UUID,
+				name:    filepath.Join(d.Path, e.Path),
+				path:    e.Path,
+				size:    e.Size,
+				modTime: e.ModTime,
+				hash:    e.Hash,
+			})
+		}
+	}
+	p.mutex.RUnlock()
+
+	// Pre-filter by size, as files of differing sizes cannot be identical.
+	var stated []*duplicateCandidate
+	bySize := make(map[int64][]*duplicateCandidate)
+	for _, c := range candidates {
+		info, err := os.Stat(c.name)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		c.info = info
+		stated = append(stated, c)
+		bySize[info.Size()] = append(bySize[info.Size()], c)
+	}
+
+	var total int
+	for _, group := range bySize {
+		if len(group) > 1 {
+			total += len(group)
+		}
+	}
+
+	hashed := 0
+	last := time.Now()
+	progress := func(force bool) {
+		if force || time.Since(last) > 250*time.Millisecond {
+			last = time.Now()
+			p.Emit(EventDuplicatesProgress, DuplicatesProgressEvent{
+				Hashed: hashed,
+				Total:  total,
+			})
+		}
+	}
+	progress(true)
+
+	for _, group := range bySize {
+		if len(group) < 2 {
+			continue
+		}
+		for _, c := range group {
+			hashed++
+			if c.hash == "" || c.info.Size() != c.size || !c.info.ModTime().Equal(c.modTime) {
+				c.hash = ""
+				if hash, err := HashFile(c.name); err == nil {
+					c.hash = hash
+				}
+			}
+			progress(false)
+		}
+	}
+	progress(true)
+
+	// Record what was seen of each file and group the entries, skipping any that a sync or watcher changed while the files were read.
+	byHash := make(map[string]*DuplicateGroup)
+	p.mutex.Lock()
+	for _, c := range stated {
+		d, err := p.GetDirectoryByUUID(c.dir)
+		if err != nil {
+			continue
+		}
+		e := d.Entry(c.path)
+		if e == nil || e.Missing || e.Size != c.size || !e.ModTime.Equal(c.modTime) {
+			continue
+		}
+		// Entries that were never stat'd have nothing to compare against.
+		known := !e.ModTime.IsZero()
+		if e.stat(c.info) && known {
+			d.Emit("change", &DirectoryEntryChangeEvent{
+				UUID:  d.UUID,
+				Entry: e,
+			})
+		}
+		if len(bySize[e.Size]) < 2 || c.hash == "" {
+			continue
+		}
+		e.Hash = c.hash
+		g, ok := byHash[e.Hash]
+		if !ok {
+			g = &DuplicateGroup{
+				Hash: e.Hash,
+				Size: e.Size,
+			}
+			byHash[e.Hash] = g
+		}
+		e2 := e.Clone()
+		g.Entries = append(g.Entries, QueryMatch{
+			Directory: d.UUID,
+			Entry:     &e2,
+		})
+	}
+	p.mutex.Unlock()
+
+	groups := make([]DuplicateGroup, 0)
+	for _, g := range byHash {
+		if len(g.Entries) > 1 {
+			groups = append(groups, *g)
+		}
+	}
+	// Largest files first, as those are the most worth cleaning up.
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Size == groups[j].Size {
+			return groups[i].Hash < groups[j].Hash
+		}
+		return groups[i].Size > groups[j].Size
+	})
+	return groups
+}
+
+// MergeTags merges the tags of the source entries onto the target entry, keeping the highest rating, as a single undoable action.
+func (p *Project) MergeTags(target EntryRef, sources []EntryRef) error {
+	_, entry, err := p.entryCopy(target.Directory, target.Path)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range sources {
+		_, e2, err := p.entryCopy(ref.Directory, ref.Path)
+		if err != nil {
+			return err
+		}
+		for _, t := range e2.Tags {
+			if !containsString(entry.Tags, t) {
+				entry.Tags = append(entry.Tags, t)
+			}
+		}
+		if e2.Rating > entry.Rating {
+			entry.Rating = e2.Rating
+		}
+	}
+
+	return p.UpdateDirectoryEntry(target.Directory, target.Path, entry)
+}
@@ -1,19 +1,28 @@
 package lib
 
+import "sync"
+
 // Emitter provides a type that can have callback functions attached to string-based events.
 type Emitter struct {
 	handlers map[string][]func(Event)
+	// mutex serializes Emit and On, as directories emit from their own sync and watcher goroutines. It is a pointer so that emitters can be copied along with the types that embed them.
+	mutex *sync.Mutex
 }
 
 // NewEmitter creates a new Emitter.
 func NewEmitter() *Emitter {
 	return &Emitter{
 		handlers: make(map[string][]func(Event)),
+		mutex:    &sync.Mutex{},
 	}
 }
 
-// Emit emits the given event with the provided data, calling all registered handlers.
+// Emit emits the given event with the provided data, calling all registered handlers. Handlers are called one emit at a time, so they must not emit on the same emitter.
 func (e *Emitter) Emit(event string, data Event) {
+	if e.mutex != nil {
+		e.mutex.Lock()
+		defer e.mutex.Unlock()
+	}
 	if h, ok := e.handlers[event]; ok {
 		for _, f := range h {
 			(f)(data)
@@ -23,6 +32,10 @@ func (e *Emitter) Emit(event string, data Event) {
 
 // On adds an event handler to a given event string.
 func (e *Emitter) On(event string, cb func(Event)) {
+	if e.mutex != nil {
+		e.mutex.Lock()
+		defer e.mutex.Unlock()
+	}
 	if _, ok := e.handlers[event]; !ok {
 		e.handlers[event] = make([]func(Event), 0)
 	}
@@ -18,6 +18,16 @@ func (e *SyncError) Error() string {
 	return s
 }
 
+// BrokenLinkError is returned for symlinks whose targets do not exist.
+type BrokenLinkError struct {
+	path   string
+	target string
+}
+
+func (e *BrokenLinkError) Error() string {
+	return fmt.Sprintf("broken link '%s' to '%s'", e.path, e.target)
+}
+
 type MissingDirectoryError struct {
 	dir  string
 	uuid uuid.UUID
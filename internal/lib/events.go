@@ -29,6 +29,7 @@ type DirectoryAddEvent struct {
 	Separator  string
 	IgnoreDot  bool
 	SyncOnLoad bool
+	Watch      bool
 }
 
 const EventDirectoryRemove string = "directory-remove"
@@ -37,6 +38,14 @@ type DirectoryRemoveEvent struct {
 	UUID uuid.UUID
 }
 
+const EventDirectoryRelocate string = "directory-relocate"
+
+type DirectoryRelocateEvent struct {
+	UUID uuid.UUID
+	From string
+	Path string
+}
+
 const EventDirectorySync string = "directory-sync"
 
 type DirectorySyncEvent struct {
@@ -50,6 +59,24 @@ type DirectorySyncedEvent struct {
 	Error error
 }
 
+const EventDirectorySyncProgress string = "directory-sync-progress"
+
+type DirectorySyncProgressEvent struct {
+	UUID        uuid.UUID
+	Directories int
+	Files       int
+	Added       int
+	Missing     int
+}
+
+const EventDirectoryWatch string = "directory-watch"
+
+type DirectoryWatchEvent struct {
+	UUID     uuid.UUID
+	Watching bool
+	Error    error
+}
+
 const EventDirectoryEntry string = "directory-entry"
 
 type DirectoryEntryEvent struct {
@@ -78,6 +105,21 @@ type DirectoryEntryUpdateEvent struct {
 	Entry *DirectoryEntry
 }
 
+const EventDirectoryEntryMove string = "directory-entry-move"
+
+type DirectoryEntryMoveEvent struct {
+	UUID  uuid.UUID
+	From  string
+	Entry *DirectoryEntry
+}
+
+const EventDirectoryEntryChange string = "directory-entry-change"
+
+type DirectoryEntryChangeEvent struct {
+	UUID  uuid.UUID
+	Entry *DirectoryEntry
+}
+
 const EventDirectoryEntryMissing string = "directory-entry-missing"
 
 type DirectoryEntryMissingEvent struct {
@@ -92,6 +134,44 @@ type DirectoryEntryFoundEvent struct {
 	Entry *DirectoryEntry
 }
 
+const EventTagRegistryUpdate string = "tag-registry-update"
+
+type TagRegistryUpdateEvent struct {
+	Registry TagRegistry
+}
+
+const EventThumbnail string = "thumbnail"
+
+type ThumbnailEvent struct {
+	ID        string
+	Path      string
+	Thumbnail Thumbnail
+	Error     string
+}
+
+const EventDuplicatesProgress string = "duplicates-progress"
+
+type DuplicatesProgressEvent struct {
+	Hashed int
+	Total  int
+}
+
+const EventExportProgress string = "export-progress"
+
+type ExportProgressEvent struct {
+	Done   int
+	Total  int
+	Target string
+}
+
+const EventExportError string = "export-error"
+
+type ExportErrorEvent struct {
+	Source string
+	Target string
+	Error  string
+}
+
 /*
 Session -> View events
 */
@@ -134,6 +214,12 @@ type ViewTagsRemoveEvent struct {
 	View *TagsView
 }
 
+const EventViewTagsUpdate string = "view-tags-update"
+
+type ViewTagsUpdateEvent struct {
+	View *TagsView
+}
+
 const EventViewSelect string = "view-select"
 
 type ViewSelectEvent struct {
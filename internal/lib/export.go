@@ -0,0 +1,171 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Export modes.
+const (
+	ExportCopy     = "copy"
+	ExportHardlink = "hardlink"
+	ExportSymlink  = "symlink"
+)
+
+// ExportOptions configures how entries are exported.
+type ExportOptions struct {
+	Mode    string `json:"Mode"`    // Mode should be copy, hardlink, or symlink. Defaults to copy.
+	Flatten bool   `json:"Flatten"` // Flatten places every file directly in the destination rather than under its path within its directory.
+	DryRun  bool   `json:"DryRun"`  // DryRun plans the export without touching the filesystem.
+}
+
+// ExportItem is a single file of an export.
+type ExportItem struct {
+	Directory uuid.UUID `json:"Directory"`
+	Path      string    `json:"Path"`
+	Source    string    `json:"Source"`
+	Target    string    `json:"Target"`
+	Error     string    `json:"Error,omitempty"`
+}
+
+// ExportModeError is returned when an unknown export mode is requested.
+type ExportModeError struct {
+	mode string
+}
+
+func (e *ExportModeError) Error() string {
+	return fmt.Sprintf("unknown export mode '%s'", e.mode)
+}
+
+// Export copies, hard-links, or symlinks the files of the given matches into dest. Existing files are never overwritten; a colliding file is instead renamed with a numbered suffix. Per-file failures are recorded in the returned items rather than stopping the export. Emits: export-progress, export-error
+func (p *Project) Export(matches []QueryMatch, dest string, opts ExportOptions) ([]ExportItem, error) {
+	if opts.Mode == "" {
+		opts.Mode = ExportCopy
+	}
+	if opts.Mode != ExportCopy && opts.Mode != ExportHardlink && opts.Mode != ExportSymlink {
+		return nil, &ExportModeError{opts.Mode}
+	}
+	dest, err := filepath.Abs(dest)
+	if err != nil {
+		return nil, err
+	}
+
+	// Plan every target first so that collisions within the export itself are resolved.
+	items := make([]ExportItem, 0, len(matches))
+	reserved := make(map[string]bool)
+	p.mutex.RLock()
+	for _, m := range matches {
+		item := ExportItem{
+			Directory: m.Directory,
+			Path:      m.Entry.Path,
+		}
+		d, err := p.GetDirectoryByUUID(m.Directory)
+		if err != nil {
+			item.Error = err.Error()
+			items = append(items, item)
+			continue
+		}
+		item.Source = filepath.Join(d.Path, m.Entry.Path)
+		if m.Entry.Missing {
+			item.Error = (&MissingEntryError{dir: d.Path, path: m.Entry.Path}).Error()
+		}
+		target := filepath.Join(dest, m.Entry.Path)
+		if opts.Flatten {
+			target = filepath.Join(dest, filepath.Base(m.Entry.Path))
+		}
+		item.Target = uniqueExportPath(target, reserved)
+		reserved[item.Target] = true
+		items = append(items, item)
+	}
+	p.mutex.RUnlock()
+	if opts.DryRun {
+		return items, nil
+	}
+
+	for i := range items {
+		item := &items[i]
+		if item.Error == "" {
+			if err := exportFile(item.Source, item.Target, opts.Mode); err != nil {
+				item.Error = err.Error()
+			}
+		}
+		if item.Error != "" {
+			p.Emit(EventExportError, ExportErrorEvent{
+				Source: item.Source,
+				Target: item.Target,
+				Error:  item.Error,
+			})
+		}
+		p.Emit(EventExportProgress, ExportProgressEvent{
+			Done:   i + 1,
+			Total:  len(items),
+			Target: item.Target,
+		})
+	}
+	return items, nil
+}
+
+// uniqueExportPath returns the given path, or the first of `name_1.ext`, `name_2.ext`, ... that neither exists nor is reserved.
+func uniqueExportPath(path string, reserved map[string]bool) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	candidate := path
+	for i := 1; ; i++ {
+		if !reserved[candidate] {
+			if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+				return candidate
+			}
+		}
+		candidate = fmt.Sprintf("%s_%d%s", base, i, ext)
+	}
+}
+
+// exportFile places source at target using the given mode.
+func exportFile(source, target string, mode string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	switch mode {
+	case ExportHardlink:
+		return os.Link(source, target)
+	case ExportSymlink:
+		abs, err := filepath.Abs(source)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(abs, target)
+	}
+	return copyFile(source, target)
+}
+
+// copyFile copies source to target, keeping its permissions and modification time.
+func copyFile(source, target string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(target)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(target)
+		return err
+	}
+	return os.Chtimes(target, info.ModTime(), info.ModTime())
+}
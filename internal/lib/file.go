@@ -5,6 +5,7 @@ import "time"
 type ImageInfo struct {
 	Width, Height int
 	ColorModel    string
+	Metadata      *ImageMetadata
 }
 
 type FileInfo struct {
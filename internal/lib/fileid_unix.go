@@ -0,0 +1,20 @@
+//go:build aix || darwin || dragonfly || freebsd || (js && wasm) || linux || netbsd || openbsd || solaris
+
+package lib
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// getFileID returns the device and inode of the file that info, as returned by os.Stat for name, describes.
+func getFileID(name string, info fs.FileInfo) (fileID, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, false
+	}
+	return fileID{
+		dev: uint64(st.Dev),
+		ino: uint64(st.Ino),
+	}, true
+}
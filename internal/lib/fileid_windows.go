@@ -0,0 +1,28 @@
+package lib
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// getFileID returns the volume serial number and file index of the given file, which are Windows' equivalent of a device and inode.
+func getFileID(name string, info fs.FileInfo) (fileID, bool) {
+	p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return fileID{}, false
+	}
+	// Backup semantics are needed to open directories.
+	h, err := syscall.CreateFile(p, 0, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, nil, syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return fileID{}, false
+	}
+	defer syscall.CloseHandle(h)
+	var d syscall.ByHandleFileInformation
+	if err := syscall.GetFileInformationByHandle(h, &d); err != nil {
+		return fileID{}, false
+	}
+	return fileID{
+		dev: uint64(d.VolumeSerialNumber),
+		ino: uint64(d.FileIndexHigh)<<32 | uint64(d.FileIndexLow),
+	}, true
+}
@@ -0,0 +1,307 @@
+package lib
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// IgnoreFile is the name of the files within a directory's tree that hold ignore patterns for the directory they are in and everything beneath it.
+const IgnoreFile = ".treesourceignore"
+
+// IgnorePatternError is returned when an ignore pattern cannot be compiled.
+type IgnorePatternError struct {
+	pattern string
+	err     error
+}
+
+func (e *IgnorePatternError) Error() string {
+	return fmt.Sprintf("invalid ignore pattern '%s': %s", e.pattern, e.err)
+}
+
+// ignoreRule is a single compiled line of .gitignore syntax.
+type ignoreRule struct {
+	base     string // base is the directory, relative to the root and separated by `/`, that the pattern is relative to.
+	negate   bool
+	dirOnly  bool
+	basename bool // basename is if the pattern has no slash and so matches names at any depth.
+	pattern  *regexp.Regexp
+}
+
+// compileIgnoreRules compiles the given lines of .gitignore syntax. Blank lines and comments are skipped.
+func compileIgnoreRules(lines []string, base string) ([]ignoreRule, error) {
+	var rules []ignoreRule
+	for _, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		// Trailing spaces are dropped unless escaped.
+		for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+			line = line[:len(line)-1]
+		}
+		r := ignoreRule{
+			base: base,
+		}
+		if line[0] == '!' {
+			r.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			line = strings.TrimPrefix(line, "/")
+		} else {
+			r.basename = true
+		}
+		if line == "" {
+			continue
+		}
+		re, err := ignoreRegexp(line)
+		if err != nil {
+			return nil, &IgnorePatternError{line, err}
+		}
+		r.pattern = re
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// ignoreRegexp converts a glob of .gitignore syntax into a regular expression. `*` and `?` do not match `/`, while `**` as a whole path component matches any number of directories.
+func ignoreRegexp(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				end := i + 2
+				if (i == 0 || glob[i-1] == '/') && (end == len(glob) || glob[end] == '/') {
+					if end == len(glob) {
+						b.WriteString(".*")
+					} else {
+						b.WriteString("(?:.*/)?")
+					}
+					i = end
+					continue
+				}
+				i++
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := i + 1
+			if end < len(glob) && (glob[end] == '!' || glob[end] == '^') {
+				end++
+			}
+			if end < len(glob) && glob[end] == ']' {
+				end++
+			}
+			for end < len(glob) && glob[end] != ']' {
+				end++
+			}
+			if end >= len(glob) {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : end]
+			if class[0] == '!' {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i = end
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// ignoreMatcher holds the rules that apply within a directory, from lowest to highest precedence.
+type ignoreMatcher struct {
+	rules []ignoreRule
+}
+
+// match returns if the given path, relative to the root and separated by `/`, is ignored by the rules. Later rules take precedence, so a negated rule can re-include what an earlier rule ignored.
+func (m *ignoreMatcher) match(local string, isDir bool) bool {
+	ignored := false
+	for _, r := range m.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		rel := local
+		if r.base != "" {
+			if !strings.HasPrefix(local, r.base+"/") {
+				continue
+			}
+			rel = local[len(r.base)+1:]
+		}
+		if r.basename {
+			rel = path.Base(rel)
+		}
+		if r.pattern.MatchString(rel) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// ignoreCache builds the matchers of a directory tree from its patterns and the IgnoreFile files within it, loading each file once.
+type ignoreCache struct {
+	root     string
+	patterns []string
+	mutex    sync.Mutex
+	matchers map[string]*ignoreMatcher
+}
+
+func newIgnoreCache(root string, patterns []string) *ignoreCache {
+	return &ignoreCache{
+		root:     root,
+		patterns: patterns,
+		matchers: make(map[string]*ignoreMatcher),
+	}
+}
+
+// matcher returns the matcher for the given directory, relative to the root and separated by `/`.
+func (c *ignoreCache) matcher(dir string) *ignoreMatcher {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.load(dir)
+}
+
+func (c *ignoreCache) load(dir string) *ignoreMatcher {
+	if m, ok := c.matchers[dir]; ok {
+		return m
+	}
+	m := &ignoreMatcher{}
+	if dir == "" {
+		// Invalid patterns are refused when they are set, so any error here can only be from a hand-edited project.
+		m.rules, _ = compileIgnoreRules(c.patterns, "")
+	} else {
+		parent := path.Dir(dir)
+		if parent == "." {
+			parent = ""
+		}
+		m.rules = c.load(parent).rules
+	}
+	if lines := readIgnoreFile(filepath.Join(c.root, filepath.FromSlash(dir), IgnoreFile)); len(lines) > 0 {
+		rules, _ := compileIgnoreRules(lines, dir)
+		m = &ignoreMatcher{
+			rules: append(append([]ignoreRule(nil), m.rules...), rules...),
+		}
+	}
+	c.matchers[dir] = m
+	return m
+}
+
+// readIgnoreFile returns the lines of the given ignore file, or nothing if it cannot be read.
+func readIgnoreFile(name string) []string {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var lines []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+	return lines
+}
+
+// ignoredIn returns if the given path within the given directory is ignored, without checking the directory itself. Both are relative to the root.
+func (c *ignoreCache) ignoredIn(dir string, local string, isDir bool) bool {
+	if dir == "." {
+		dir = ""
+	}
+	return c.matcher(filepath.ToSlash(dir)).match(filepath.ToSlash(local), isDir)
+}
+
+// Ignored returns if the given path, relative to the root, or any directory above it is ignored.
+func (c *ignoreCache) Ignored(local string, isDir bool) bool {
+	local = filepath.ToSlash(local)
+	dir := ""
+	for _, part := range strings.Split(path.Dir(local), "/") {
+		if part == "." {
+			break
+		}
+		next := path.Join(dir, part)
+		if c.matcher(dir).match(next, true) {
+			return true
+		}
+		dir = next
+	}
+	return c.matcher(dir).match(local, isDir)
+}
+
+// IgnoredEntries returns the paths of the given directory's entries that the given ignore patterns, along with any IgnoreFile files within the directory, would leave out.
+func (p *Project) IgnoredEntries(u uuid.UUID, patterns []string) ([]string, error) {
+	if _, err := compileIgnoreRules(patterns, ""); err != nil {
+		return nil, err
+	}
+	var ignored []string
+	err := p.readDirectory(u, func(d *Directory) {
+		ignored = d.ignoredEntries(newIgnoreCache(d.Path, patterns))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ignored, nil
+}
+
+// ignoredEntries returns the paths of the directory's entries that the given ignores leave out.
+func (d *Directory) ignoredEntries(ignores *ignoreCache) []string {
+	ignored := make([]string, 0)
+	for _, e := range d.Entries {
+		if ignores.Ignored(e.Path, false) {
+			ignored = append(ignored, e.Path)
+		}
+	}
+	return ignored
+}
+
+// SetDirectoryIgnore sets the given directory's ignore patterns and removes any entries they leave out, as a single undoable action. Setting the same patterns again re-evaluates the entries, such as after an IgnoreFile was changed, as syncs only mark the entries that became ignored as missing. The removed entries' paths are returned.
+func (p *Project) SetDirectoryIgnore(u uuid.UUID, patterns []string) ([]string, error) {
+	if _, err := compileIgnoreRules(patterns, ""); err != nil {
+		return nil, err
+	}
+	// The IgnoreFile files of the entries are read beforehand, so that they are not read while the write lock is held.
+	var ignores *ignoreCache
+	err := p.readDirectory(u, func(d *Directory) {
+		ignores = newIgnoreCache(d.Path, patterns)
+		d.ignoredEntries(ignores)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	a := &SetDirectoryIgnoreAction{
+		UUID:     u,
+		Patterns: append([]string(nil), patterns...),
+		ignores:  ignores,
+	}
+	p.mutex.Lock()
+	p.history.PushAndApply(a)
+	dropped := make([]string, 0, len(a.removed))
+	for _, r := range a.removed {
+		dropped = append(dropped, r.Path)
+	}
+	p.unlock()
+	return dropped, nil
+}
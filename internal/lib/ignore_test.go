@@ -0,0 +1,224 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestIgnoreRegexp(t *testing.T) {
+	tests := []struct {
+		glob string
+		path string
+		want bool
+	}{
+		{"*.png", "a.png", true},
+		{"*.png", "a.jpg", false},
+		{"*.png", "dir/a.png", false},
+		{"a?c", "abc", true},
+		{"a?c", "a/c", false},
+		{"a?c", "ac", false},
+		{"**/x", "x", true},
+		{"**/x", "a/b/x", true},
+		{"**/x", "a/bx", false},
+		{"a/**", "a/b", true},
+		{"a/**", "a/b/c", true},
+		{"a/**", "a", false},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"a/**/b", "a/xb", false},
+		{"a**b", "axyb", true},
+		{"a**b", "ax/yb", false},
+		{"[abc].txt", "b.txt", true},
+		{"[abc].txt", "d.txt", false},
+		{"[!abc].txt", "d.txt", true},
+		{"[!abc].txt", "a.txt", false},
+		{"[]a].txt", "].txt", true},
+		{"[a-c]", "b", true},
+		{"[a", "[a", true},
+		{`\*.png`, "*.png", true},
+		{`\*.png`, "a.png", false},
+		{`\#1`, "#1", true},
+		{"a.b", "axb", false},
+		{"a+(b)", "a+(b)", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.glob+" "+tt.path, func(t *testing.T) {
+			re, err := ignoreRegexp(tt.glob)
+			if err != nil {
+				t.Fatalf("ignoreRegexp(%q) error = %v", tt.glob, err)
+			}
+			if got := re.MatchString(tt.path); got != tt.want {
+				t.Errorf("ignoreRegexp(%q) = %s, matching %q = %v, want %v", tt.glob, re, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIgnoreMatcherMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		base     string
+		path     string
+		isDir    bool
+		want     bool
+	}{
+		{"no rules", nil, "", "a.png", false, false},
+		{"basename at root", []string{"*.log"}, "", "a.log", false, true},
+		{"basename at any depth", []string{"*.log"}, "", "x/y/a.log", false, true},
+		{"anchored", []string{"/a.txt"}, "", "a.txt", false, true},
+		{"anchored not nested", []string{"/a.txt"}, "", "x/a.txt", false, false},
+		{"middle slash anchors", []string{"doc/*.md"}, "", "doc/a.md", false, true},
+		{"middle slash not nested", []string{"doc/*.md"}, "", "x/doc/a.md", false, false},
+		{"middle slash star stays in its directory", []string{"doc/*.md"}, "", "doc/x/a.md", false, false},
+		{"double star", []string{"**/cache"}, "", "a/b/cache", true, true},
+		{"dir only matches directories", []string{"build/"}, "", "build", true, true},
+		{"dir only skips files", []string{"build/"}, "", "build", false, false},
+		{"dir only at any depth", []string{"build/"}, "", "x/build", true, true},
+		{"anchored dir only", []string{"/build/"}, "", "x/build", true, false},
+		{"negation", []string{"*.png", "!keep.png"}, "", "keep.png", false, false},
+		{"negation leaves others", []string{"*.png", "!keep.png"}, "", "drop.png", false, true},
+		{"later rule wins", []string{"!keep.png", "*.png"}, "", "keep.png", false, true},
+		{"negation alone", []string{"!keep.png"}, "", "keep.png", false, false},
+		{"negated dir only", []string{"*", "!dir/"}, "", "dir", true, false},
+		{"negated dir only skips files", []string{"*", "!dir/"}, "", "dir", false, true},
+		{"comments and blanks", []string{"# *.png", "", "*.jpg"}, "", "#.png", false, false},
+		{"trailing spaces", []string{"a.txt  "}, "", "a.txt", false, true},
+		{"escaped trailing space", []string{`a\ `}, "", "a ", false, true},
+		{"escaped negation", []string{`\!a`}, "", "!a", false, true},
+		{"base", []string{"/a.txt"}, "sub", "sub/a.txt", false, true},
+		{"base outside", []string{"*.txt"}, "sub", "a.txt", false, false},
+		{"base sibling with shared prefix", []string{"*.txt"}, "sub", "subway/a.txt", false, false},
+		{"base basename at depth", []string{"*.txt"}, "sub", "sub/x/a.txt", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := compileIgnoreRules(tt.patterns, tt.base)
+			if err != nil {
+				t.Fatalf("compileIgnoreRules(%q) error = %v", tt.patterns, err)
+			}
+			m := &ignoreMatcher{rules: rules}
+			if got := m.match(tt.path, tt.isDir); got != tt.want {
+				t.Errorf("match(%q, %v) with %q = %v, want %v", tt.path, tt.isDir, tt.patterns, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIgnoreCacheIgnored(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "sub", IgnoreFile), []byte("*.tmp\n!*.png\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := newIgnoreCache(root, []string{"build/", "*.png"})
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"a.png", false, true},
+		{"a.tmp", false, false},
+		{"build", true, true},
+		{"build/a.txt", false, true},
+		{"x/build/a.txt", false, true},
+		{"sub/a.tmp", false, true},
+		{"sub/x/a.tmp", false, true},
+		{"sub/a.png", false, false},
+		{"sub/build/a.png", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := c.Ignored(filepath.FromSlash(tt.path), tt.isDir); got != tt.want {
+				t.Errorf("Ignored(%q, %v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileIgnoreRulesError(t *testing.T) {
+	if _, err := compileIgnoreRules([]string{"[z-a]"}, ""); err == nil {
+		t.Errorf("compileIgnoreRules([z-a]) error = nil, want an IgnorePatternError")
+	} else if _, ok := err.(*IgnorePatternError); !ok {
+		t.Errorf("compileIgnoreRules([z-a]) error = %T, want *IgnorePatternError", err)
+	}
+}
+
+// ignoreProject returns a project of a synced directory holding the given files.
+func ignoreProject(t *testing.T, files ...string) (*Project, *Directory) {
+	t.Helper()
+	root := t.TempDir()
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(root, f), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := NewProject()
+	p.Directories = []Directory{{
+		Emitter: *NewEmitter(),
+		UUID:    uuid.New(),
+		Path:    root,
+	}}
+	d := &p.Directories[0]
+	if err := d.SyncEntries(); err != nil {
+		t.Fatal(err)
+	}
+	return p, d
+}
+
+func entryPaths(d *Directory) []string {
+	var paths []string
+	for _, e := range d.Entries {
+		if !e.Missing {
+			paths = append(paths, e.Path)
+		}
+	}
+	return paths
+}
+
+func TestSetDirectoryIgnore(t *testing.T) {
+	p, d := ignoreProject(t, "a.png", "b.txt")
+	dropped, err := p.SetDirectoryIgnore(d.UUID, []string{"*.txt"})
+	if err != nil {
+		t.Fatalf("SetDirectoryIgnore() error = %v", err)
+	}
+	if want := []string{"b.txt"}; !reflect.DeepEqual(dropped, want) {
+		t.Errorf("SetDirectoryIgnore() dropped %q, want %q", dropped, want)
+	}
+	if got, want := entryPaths(d), []string{"a.png"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("entries after SetDirectoryIgnore() = %q, want %q", got, want)
+	}
+	p.Undo()
+	if got, want := entryPaths(d), []string{"a.png", "b.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("entries after Undo() = %q, want %q", got, want)
+	}
+	if len(d.Ignore) != 0 {
+		t.Errorf("patterns after Undo() = %q, want none", d.Ignore)
+	}
+}
+
+func TestSyncMarksIgnoredEntriesMissing(t *testing.T) {
+	p, d := ignoreProject(t, "a.png", "b.txt")
+	if err := os.WriteFile(filepath.Join(d.Path, IgnoreFile), []byte("*.txt\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SyncEntries(); err != nil {
+		t.Fatal(err)
+	}
+	if e := d.Entry("b.txt"); e == nil || !e.Missing {
+		t.Fatalf("b.txt after sync = %+v, want it missing", e)
+	}
+	dropped, err := p.SetDirectoryIgnore(d.UUID, nil)
+	if err != nil {
+		t.Fatalf("SetDirectoryIgnore() error = %v", err)
+	}
+	if want := []string{"b.txt"}; !reflect.DeepEqual(dropped, want) {
+		t.Errorf("SetDirectoryIgnore() dropped %q, want %q", dropped, want)
+	}
+}
@@ -0,0 +1,347 @@
+package lib
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"treesource/internal/do"
+)
+
+// Import modes.
+const (
+	ImportMerge   = "merge"   // ImportMerge adds imported tags to an entry's existing tags.
+	ImportReplace = "replace" // ImportReplace replaces an entry's tags with the imported tags.
+)
+
+// CaptionExtensions are the extensions of the sidecar files read by ImportCaptions.
+var CaptionExtensions = []string{".txt", ".caption"}
+
+// ImportReport describes the result of an import.
+type ImportReport struct {
+	Matched   int               `json:"Matched"` // Matched is the number of entries that rows or sidecars matched.
+	Changed   int               `json:"Changed"` // Changed is the number of entries whose tags or rating changed.
+	Unmatched []ImportUnmatched `json:"Unmatched"`
+}
+
+// ImportUnmatched is a CSV row or sidecar file that matched no entry.
+type ImportUnmatched struct {
+	Source string `json:"Source"`         // Source is the CSV or sidecar file.
+	Line   int    `json:"Line,omitempty"` // Line is the row's line within a CSV file.
+	Path   string `json:"Path"`           // Path is the entry path that was looked for.
+}
+
+// ImportModeError is returned when an unknown import mode is requested.
+type ImportModeError struct {
+	mode string
+}
+
+func (e *ImportModeError) Error() string {
+	return fmt.Sprintf("unknown import mode '%s'", e.mode)
+}
+
+// ImportFormatError is returned when an import file cannot be understood.
+type ImportFormatError struct {
+	source  string
+	message string
+}
+
+func (e *ImportFormatError) Error() string {
+	return fmt.Sprintf("cannot import '%s': %s", e.source, e.message)
+}
+
+// tagImport collects the changes for the entries of a directory so they can be applied together.
+type tagImport struct {
+	dir     *Directory
+	mode    string
+	order   []string
+	entries map[string]*DirectoryEntry
+	report  ImportReport
+}
+
+func newTagImport(d *Directory, mode string) (*tagImport, error) {
+	if mode == "" {
+		mode = ImportMerge
+	}
+	if mode != ImportMerge && mode != ImportReplace {
+		return nil, &ImportModeError{mode}
+	}
+	return &tagImport{
+		dir:     d,
+		mode:    mode,
+		entries: make(map[string]*DirectoryEntry),
+		report: ImportReport{
+			Unmatched: make([]ImportUnmatched, 0),
+		},
+	}, nil
+}
+
+// entry returns the pending copy of the entry at the given path, or nil if there is no such entry.
+func (t *tagImport) entry(path string) *DirectoryEntry {
+	if e, ok := t.entries[path]; ok {
+		return e
+	}
+	e := t.dir.Entry(path)
+	if e == nil {
+		return nil
+	}
+	e2 := e.Clone()
+	if t.mode == ImportReplace {
+		e2.Tags = nil
+	}
+	t.entries[path] = &e2
+	t.order = append(t.order, path)
+	return &e2
+}
+
+// add adds tags to the pending copy of the entry at the given path, returning false if there is no such entry.
+func (t *tagImport) add(path string, tags []string) bool {
+	e := t.entry(path)
+	if e == nil {
+		return false
+	}
+	for _, tag := range tags {
+		if !containsString(e.Tags, tag) {
+			e.Tags = append(e.Tags, tag)
+		}
+	}
+	return true
+}
+
+// apply pushes every changed entry as a single undoable action.
+func (t *tagImport) apply(p *Project) ImportReport {
+	var actions []do.Action[*Project]
+	p.mutex.RLock()
+	for _, path := range t.order {
+		entry := *t.entries[path]
+		entry.Tags = p.TagRegistry.Apply(entry.Tags)
+		e := t.dir.Entry(path)
+		if e.Rating == entry.Rating && equalStrings(e.Tags, entry.Tags) {
+			continue
+		}
+		actions = append(actions, &UpdateEntryAction{
+			UUID:  t.dir.UUID,
+			path:  path,
+			Entry: entry,
+		})
+	}
+	p.mutex.RUnlock()
+	t.report.Matched = len(t.order)
+	t.report.Changed = len(actions)
+	if len(actions) > 0 {
+		p.apply(&GroupedAction{
+			Actions: actions,
+		})
+	}
+	return t.report
+}
+
+// relativePath returns the given path relative to the directory, using the platform's separator.
+func (t *tagImport) relativePath(path string) string {
+	path = filepath.FromSlash(strings.TrimSpace(path))
+	if filepath.IsAbs(path) {
+		if rel, err := filepath.Rel(t.dir.Path, path); err == nil {
+			path = rel
+		}
+	}
+	return filepath.Clean(path)
+}
+
+// ImportTagsCSV imports tags and ratings from a CSV file of path, tags, and rating columns into the entries of the given directory as a single undoable action. If the first row names a `path` column, columns are found by the header's `path`, `tags`, and `rating` names. Tags are separated by commas or semicolons, and paths may be absolute or relative to the directory. An empty rating leaves an entry's rating as is.
+func (p *Project) ImportTagsCSV(u uuid.UUID, name string, mode string) (ImportReport, error) {
+	p.mutex.RLock()
+	t, err := p.importTagsCSV(u, name, mode)
+	p.mutex.RUnlock()
+	if err != nil {
+		return ImportReport{}, err
+	}
+	return t.apply(p), nil
+}
+
+// importTagsCSV reads the CSV file into a pending import. The read lock must be held.
+func (p *Project) importTagsCSV(u uuid.UUID, name string, mode string) (*tagImport, error) {
+	d, err := p.GetDirectoryByUUID(u)
+	if err != nil {
+		return nil, err
+	}
+	t, err := newTagImport(d, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	columns := map[string]int{"path": 0, "tags": 1, "rating": 2}
+	field := func(record []string, column string) string {
+		if i, ok := columns[column]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	for first := true; ; first = false {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, &ImportFormatError{name, err.Error()}
+		}
+		line, _ := r.FieldPos(0)
+		if first {
+			header := make(map[string]int)
+			for i, v := range record {
+				header[strings.ToLower(strings.TrimSpace(v))] = i
+			}
+			if _, ok := header["path"]; ok {
+				columns = header
+				continue
+			}
+		}
+
+		path := field(record, "path")
+		if path == "" {
+			continue
+		}
+		path = t.relativePath(path)
+		tags := splitTags(field(record, "tags"), ",;")
+		if !t.add(path, tags) {
+			t.report.Unmatched = append(t.report.Unmatched, ImportUnmatched{
+				Source: name,
+				Line:   line,
+				Path:   path,
+			})
+			continue
+		}
+		if rating := field(record, "rating"); rating != "" {
+			v, err := strconv.ParseFloat(rating, 64)
+			if err != nil {
+				return nil, &ImportFormatError{name, fmt.Sprintf("line %d: invalid rating '%s'", line, rating)}
+			}
+			t.entry(path).Rating = v
+		}
+	}
+	return t, nil
+}
+
+// ImportCaptions imports tags from caption sidecar files within the given directory as a single undoable action. A sidecar such as `hero.txt` or `hero.png.caption` holds comma or newline separated tags for `hero.png`. A sidecar without an extension on its base name applies to every entry that shares its name.
+func (p *Project) ImportCaptions(u uuid.UUID, mode string) (ImportReport, error) {
+	p.mutex.RLock()
+	t, err := p.importCaptions(u, mode)
+	p.mutex.RUnlock()
+	if err != nil {
+		return ImportReport{}, err
+	}
+	return t.apply(p), nil
+}
+
+// importCaptions reads the directory's caption sidecars into a pending import. The read lock must be held.
+func (p *Project) importCaptions(u uuid.UUID, mode string) (*tagImport, error) {
+	d, err := p.GetDirectoryByUUID(u)
+	if err != nil {
+		return nil, err
+	}
+	t, err := newTagImport(d, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	isCaption := func(path string) bool {
+		return containsString(CaptionExtensions, strings.ToLower(filepath.Ext(path)))
+	}
+	// Map extensionless names to entries so that `hero.txt` can find `hero.png`.
+	stems := make(map[string][]string)
+	for _, e := range d.Entries {
+		if isCaption(e.Path) {
+			continue
+		}
+		stem := strings.TrimSuffix(e.Path, filepath.Ext(e.Path))
+		stems[stem] = append(stems[stem], e.Path)
+	}
+
+	err = filepath.WalkDir(d.Path, func(name string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IgnoreDot && name != d.Path && strings.HasPrefix(de.Name(), ".") {
+			if de.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if de.IsDir() || !isCaption(name) {
+			return nil
+		}
+		rel, err := filepath.Rel(d.Path, name)
+		if err != nil {
+			return err
+		}
+		target := strings.TrimSuffix(rel, filepath.Ext(rel))
+
+		var targets []string
+		if e := d.Entry(target); e != nil && !isCaption(target) {
+			targets = append(targets, target)
+		} else {
+			targets = stems[target]
+		}
+		if len(targets) == 0 {
+			t.report.Unmatched = append(t.report.Unmatched, ImportUnmatched{
+				Source: name,
+				Path:   target,
+			})
+			return nil
+		}
+
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		tags := splitTags(string(b), ",\n")
+		for _, path := range targets {
+			t.add(path, tags)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// splitTags splits s by any of the given separators, dropping empty tags and surrounding whitespace.
+func splitTags(s string, separators string) []string {
+	var tags []string
+	for _, tag := range strings.FieldsFunc(s, func(r rune) bool {
+		return strings.ContainsRune(separators, r)
+	}) {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// equalStrings returns if a and b hold the same strings in the same order.
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
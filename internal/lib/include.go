@@ -0,0 +1,129 @@
+package lib
+
+import (
+	"fmt"
+	"mime"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// IncludeFilter limits which files become entries of a directory. A file must match one of the extensions or MIME globs, if there are any, and be within the size range.
+type IncludeFilter struct {
+	// Extensions are matched against the end of file names regardless of case, such as ".png".
+	Extensions []string `json:"Extensions" yaml:"Extensions,omitempty"`
+	// MIME holds globs, such as "image/*", matched against the MIME type of each file's extension.
+	MIME []string `json:"MIME" yaml:"MIME,omitempty"`
+	// MinSize and MaxSize are the range of file sizes in bytes. A MaxSize of 0 has no upper limit.
+	MinSize int64 `json:"MinSize" yaml:"MinSize,omitempty"`
+	MaxSize int64 `json:"MaxSize" yaml:"MaxSize,omitempty"`
+}
+
+// IncludeFilterError is returned when an include filter is invalid.
+type IncludeFilterError struct {
+	message string
+}
+
+func (e *IncludeFilterError) Error() string {
+	return fmt.Sprintf("invalid include filter: %s", e.message)
+}
+
+// Clone returns a copy of the filter.
+func (f *IncludeFilter) Clone() *IncludeFilter {
+	if f == nil {
+		return nil
+	}
+	return &IncludeFilter{
+		Extensions: append([]string(nil), f.Extensions...),
+		MIME:       append([]string(nil), f.MIME...),
+		MinSize:    f.MinSize,
+		MaxSize:    f.MaxSize,
+	}
+}
+
+// Validate returns an error if any of the filter's MIME globs are malformed or its size range is empty.
+func (f *IncludeFilter) Validate() error {
+	if f == nil {
+		return nil
+	}
+	for _, glob := range f.MIME {
+		if _, err := path.Match(glob, ""); err != nil {
+			return &IncludeFilterError{fmt.Sprintf("bad MIME glob '%s'", glob)}
+		}
+	}
+	if f.MinSize < 0 || f.MaxSize < 0 {
+		return &IncludeFilterError{"sizes cannot be negative"}
+	}
+	if f.MaxSize != 0 && f.MinSize > f.MaxSize {
+		return &IncludeFilterError{fmt.Sprintf("minimum size %d is larger than maximum size %d", f.MinSize, f.MaxSize)}
+	}
+	return nil
+}
+
+// Matches returns if a file of the given path and size is included by the filter. A nil filter includes everything.
+func (f *IncludeFilter) Matches(name string, size int64) bool {
+	if f == nil {
+		return true
+	}
+	if size < f.MinSize || (f.MaxSize != 0 && size > f.MaxSize) {
+		return false
+	}
+	if len(f.Extensions) == 0 && len(f.MIME) == 0 {
+		return true
+	}
+	lower := strings.ToLower(name)
+	for _, ext := range f.Extensions {
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if strings.HasSuffix(lower, strings.ToLower(ext)) {
+			return true
+		}
+	}
+	if len(f.MIME) > 0 {
+		mimetype, _, _ := mime.ParseMediaType(mime.TypeByExtension(filepath.Ext(name)))
+		if mimetype == "" {
+			return false
+		}
+		for _, glob := range f.MIME {
+			if ok, _ := path.Match(strings.ToLower(glob), mimetype); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ExcludedEntries returns the paths of the given directory's entries that the given include filter does not match. Missing entries are matched by their last seen size.
+func (p *Project) ExcludedEntries(u uuid.UUID, filter *IncludeFilter) ([]string, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	excluded := make([]string, 0)
+	err := p.readDirectory(u, func(d *Directory) {
+		for _, e := range d.Entries {
+			if !filter.Matches(e.Path, e.Size) {
+				excluded = append(excluded, e.Path)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return excluded, nil
+}
+
+// SetDirectoryInclude sets the include filter of the given directory, or clears it if filter is nil. Existing entries are kept, but the paths of those that no longer match are returned.
+func (p *Project) SetDirectoryInclude(u uuid.UUID, filter *IncludeFilter) ([]string, error) {
+	excluded, err := p.ExcludedEntries(u, filter)
+	if err != nil {
+		return nil, err
+	}
+	p.apply(&SetDirectoryIncludeAction{
+		UUID:    u,
+		Include: filter.Clone(),
+	})
+	return excluded, nil
+}
@@ -0,0 +1,474 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/xml"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ImageMetadata is the provenance embedded in an image's EXIF, XMP, or PNG text chunks.
+type ImageMetadata struct {
+	Camera      string
+	Lens        string
+	Orientation int // Orientation is the EXIF orientation, from 1 to 8, or 0 if unknown.
+	Created     *time.Time
+	Software    string
+	Generator   string            // Generator is the generation parameters, such as the prompt, that AI tools store in PNG text chunks.
+	Text        map[string]string // Text is every PNG text chunk by keyword.
+	XMP         map[string]string // XMP is every simple XMP property by its prefixed name, such as `xmp:CreatorTool`.
+}
+
+// generatorKeys are PNG text keywords that generators store their parameters under, in order of preference.
+var generatorKeys = []string{"parameters", "prompt", "workflow", "Dream", "sd-metadata", "Description", "Comment"}
+
+// metadataMaxChunk limits the size of a single segment, chunk, or value that is read, so that a corrupt length never allocates more than this.
+const metadataMaxChunk = 16 << 20
+
+// ReadImageMetadata reads the EXIF, XMP, and PNG text metadata of the given JPEG, PNG, TIFF, or WebP file. It returns nil if the file carries none. Only the metadata is read from the file, skipping over or stopping at its image data.
+func ReadImageMetadata(path string) (*ImageMetadata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	b := make([]byte, 12)
+	n, err := io.ReadFull(f, b)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	b = b[:n]
+
+	m := &metadataReader{}
+	switch {
+	case bytes.HasPrefix(b, []byte{0xff, 0xd8}):
+		m.readJPEG(io.NewSectionReader(f, 2, size-2))
+	case bytes.HasPrefix(b, []byte("\x89PNG\r\n\x1a\n")):
+		m.readPNG(io.NewSectionReader(f, 8, size-8))
+	case bytes.HasPrefix(b, []byte("II*\x00")) || bytes.HasPrefix(b, []byte("MM\x00*")):
+		m.readTIFF(io.NewSectionReader(f, 0, size), true)
+	case len(b) >= 12 && string(b[0:4]) == "RIFF" && string(b[8:12]) == "WEBP":
+		m.readWebP(io.NewSectionReader(f, 12, size-12))
+	}
+	return m.metadata(), nil
+}
+
+// section returns a reader of the given bytes, for metadata that is embedded within other metadata.
+func section(b []byte) *io.SectionReader {
+	return io.NewSectionReader(bytes.NewReader(b), 0, int64(len(b)))
+}
+
+// metadataReader accumulates metadata from each source, with EXIF taking precedence over XMP.
+type metadataReader struct {
+	exif map[uint16]string
+	text map[string]string
+	xmp  map[string]string
+}
+
+func (m *metadataReader) metadata() *ImageMetadata {
+	if len(m.exif) == 0 && len(m.text) == 0 && len(m.xmp) == 0 {
+		return nil
+	}
+	md := &ImageMetadata{
+		Text: m.text,
+		XMP:  m.xmp,
+	}
+	first := func(values ...string) string {
+		for _, v := range values {
+			if v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	maker := first(m.exif[exifMake], m.xmp["tiff:Make"])
+	model := first(m.exif[exifModel], m.xmp["tiff:Model"])
+	// Models often repeat the make.
+	if maker != "" && !strings.HasPrefix(model, maker) {
+		md.Camera = strings.TrimSpace(maker + " " + model)
+	} else {
+		md.Camera = model
+	}
+	md.Lens = first(m.exif[exifLensModel], m.xmp["exifEX:LensModel"], m.xmp["aux:Lens"])
+	md.Orientation, _ = strconv.Atoi(first(m.exif[exifOrientation], m.xmp["tiff:Orientation"]))
+	md.Software = first(m.exif[exifSoftware], m.xmp["xmp:CreatorTool"], m.text["Software"])
+	for _, k := range generatorKeys {
+		if v := m.text[k]; v != "" {
+			md.Generator = v
+			break
+		}
+	}
+
+	if t, err := time.Parse("2006:01:02 15:04:05", first(m.exif[exifDateTimeOriginal], m.exif[exifDateTime])); err == nil {
+		md.Created = &t
+	} else if v := first(m.xmp["exif:DateTimeOriginal"], m.xmp["photoshop:DateCreated"], m.xmp["xmp:CreateDate"], m.text["Creation Time"]); v != "" {
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02", time.RFC1123Z, time.RFC1123} {
+			if t, err := time.Parse(layout, v); err == nil {
+				md.Created = &t
+				break
+			}
+		}
+	}
+	return md
+}
+
+// JPEG
+
+// readJPEG reads the APP1 segments of JPEG data following its start of image marker, stopping at the start of the scan.
+func (m *metadataReader) readJPEG(r io.Reader) {
+	br := bufio.NewReader(r)
+	head := make([]byte, 2)
+	for {
+		if _, err := io.ReadFull(br, head); err != nil || head[0] != 0xff {
+			return
+		}
+		marker := head[1]
+		// Markers without a length.
+		if marker == 0xd8 || marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7) {
+			continue
+		}
+		// Start of scan, after which only image data follows.
+		if marker == 0xda || marker == 0xd9 {
+			return
+		}
+		if _, err := io.ReadFull(br, head); err != nil {
+			return
+		}
+		size := int(binary.BigEndian.Uint16(head)) - 2
+		if size < 0 {
+			return
+		}
+		if marker != 0xe1 {
+			if _, err := br.Discard(size); err != nil {
+				return
+			}
+			continue
+		}
+		segment := make([]byte, size)
+		if _, err := io.ReadFull(br, segment); err != nil {
+			return
+		}
+		if bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			m.readTIFF(section(segment[6:]), false)
+		} else if bytes.HasPrefix(segment, []byte("http://ns.adobe.com/xap/1.0/\x00")) {
+			m.readXMP(segment[len("http://ns.adobe.com/xap/1.0/\x00"):])
+		}
+	}
+}
+
+// PNG
+
+// readPNG reads the text and EXIF chunks of PNG data following its signature. As text may follow the image data, every other chunk is skipped over without being read.
+func (m *metadataReader) readPNG(r *io.SectionReader) {
+	head := make([]byte, 8)
+	for offset := int64(0); offset+12 <= r.Size(); {
+		if _, err := r.ReadAt(head, offset); err != nil {
+			return
+		}
+		size := int64(binary.BigEndian.Uint32(head[0:4]))
+		kind := string(head[4:8])
+		// Chunks are followed by their CRC.
+		next := offset + 12 + size
+		if kind == "IEND" || next > r.Size() {
+			return
+		}
+		if (kind != "tEXt" && kind != "zTXt" && kind != "iTXt" && kind != "eXIf") || size > metadataMaxChunk {
+			offset = next
+			continue
+		}
+		data := make([]byte, size)
+		if _, err := r.ReadAt(data, offset+8); err != nil {
+			return
+		}
+		offset = next
+		switch kind {
+		case "tEXt":
+			if k, v, ok := cutByte(data, 0); ok {
+				m.addText(latin1(k), latin1(v))
+			}
+		case "zTXt":
+			if k, v, ok := cutByte(data, 0); ok && len(v) > 0 {
+				if text, err := inflate(v[1:]); err == nil {
+					m.addText(latin1(k), latin1(text))
+				}
+			}
+		case "iTXt":
+			k, rest, ok := cutByte(data, 0)
+			if !ok || len(rest) < 2 {
+				break
+			}
+			compressed := rest[0] == 1
+			// Skip the language tag and translated keyword.
+			_, rest, ok = cutByte(rest[2:], 0)
+			if !ok {
+				break
+			}
+			_, text, ok := cutByte(rest, 0)
+			if !ok {
+				break
+			}
+			if compressed {
+				var err error
+				if text, err = inflate(text); err != nil {
+					break
+				}
+			}
+			if string(k) == "XML:com.adobe.xmp" {
+				m.readXMP(text)
+			} else {
+				m.addText(string(k), string(text))
+			}
+		case "eXIf":
+			m.readTIFF(section(data), false)
+		}
+	}
+}
+
+func (m *metadataReader) addText(k, v string) {
+	if m.text == nil {
+		m.text = make(map[string]string)
+	}
+	m.text[k] = v
+}
+
+func cutByte(b []byte, sep byte) ([]byte, []byte, bool) {
+	if i := bytes.IndexByte(b, sep); i != -1 {
+		return b[:i], b[i+1:], true
+	}
+	return b, nil, false
+}
+
+// latin1 converts ISO 8859-1 text, which tEXt and zTXt chunks use, to UTF-8.
+func latin1(b []byte) string {
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+func inflate(b []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// WebP
+
+// readWebP reads the EXIF and XMP chunks of WebP data following its RIFF header. As these chunks follow the image data, every other chunk is skipped over without being read.
+func (m *metadataReader) readWebP(r *io.SectionReader) {
+	head := make([]byte, 8)
+	for offset := int64(0); offset+8 <= r.Size(); {
+		if _, err := r.ReadAt(head, offset); err != nil {
+			return
+		}
+		kind := string(head[0:4])
+		size := int64(binary.LittleEndian.Uint32(head[4:8]))
+		if offset+8+size > r.Size() {
+			return
+		}
+		if (kind == "EXIF" || kind == "XMP ") && size <= metadataMaxChunk {
+			data := make([]byte, size)
+			if _, err := r.ReadAt(data, offset+8); err != nil {
+				return
+			}
+			if kind == "EXIF" {
+				m.readTIFF(section(bytes.TrimPrefix(data, []byte("Exif\x00\x00"))), false)
+			} else {
+				m.readXMP(data)
+			}
+		}
+		offset += 8 + size + size%2
+	}
+}
+
+// EXIF
+
+const (
+	exifMake             uint16 = 0x010f
+	exifModel            uint16 = 0x0110
+	exifOrientation      uint16 = 0x0112
+	exifSoftware         uint16 = 0x0131
+	exifDateTime         uint16 = 0x0132
+	exifXMP              uint16 = 0x02bc
+	exifIFDPointer       uint16 = 0x8769
+	exifDateTimeOriginal uint16 = 0x9003
+	exifLensModel        uint16 = 0xa434
+)
+
+// readTIFF reads the EXIF tags of the first IFD, and of the EXIF IFD it points to, from TIFF-structured data. If xmp is true, an XMP packet stored in the IFD is also read, as only TIFF files themselves store one there.
+func (m *metadataReader) readTIFF(r *io.SectionReader, xmp bool) {
+	// read returns the given range of the data, or nil if it is out of bounds.
+	read := func(offset int64, size int64) []byte {
+		if offset < 0 || size < 0 || size > metadataMaxChunk || offset+size > r.Size() {
+			return nil
+		}
+		b := make([]byte, size)
+		if _, err := r.ReadAt(b, offset); err != nil {
+			return nil
+		}
+		return b
+	}
+	b := read(0, 8)
+	if b == nil {
+		return
+	}
+	var order binary.ByteOrder
+	switch string(b[0:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return
+	}
+	if m.exif == nil {
+		m.exif = make(map[uint16]string)
+	}
+
+	visited := make(map[uint32]bool)
+	var readIFD func(offset uint32)
+	readIFD = func(offset uint32) {
+		if visited[offset] {
+			return
+		}
+		visited[offset] = true
+		c := read(int64(offset), 2)
+		if c == nil {
+			return
+		}
+		// Read every entry that fits at once, rather than each separately.
+		count := int64(order.Uint16(c))
+		if fits := (r.Size() - int64(offset) - 2) / 12; count > fits {
+			count = fits
+		}
+		entries := read(int64(offset)+2, count*12)
+		for i := int64(0); i < count && entries != nil; i++ {
+			entry := entries[i*12 : i*12+12]
+			tag := order.Uint16(entry[0:])
+			kind := order.Uint16(entry[2:])
+			n := order.Uint32(entry[4:])
+			value := entry[8:12]
+
+			// Values that do not fit in four bytes are stored at an offset.
+			size := int64(n)
+			switch kind {
+			case 3:
+				size *= 2
+			case 4:
+				size *= 4
+			}
+			if size > 4 {
+				if value = read(int64(order.Uint32(value)), size); value == nil {
+					continue
+				}
+			}
+
+			switch tag {
+			case exifIFDPointer:
+				readIFD(order.Uint32(value))
+			case exifOrientation:
+				if kind == 3 {
+					m.exif[tag] = strconv.Itoa(int(order.Uint16(value)))
+				}
+			case exifXMP:
+				if xmp {
+					m.readXMP(value)
+				}
+			case exifMake, exifModel, exifSoftware, exifDateTime, exifDateTimeOriginal, exifLensModel:
+				if kind == 2 {
+					m.exif[tag] = strings.TrimSpace(strings.TrimRight(string(value), "\x00"))
+				}
+			}
+		}
+	}
+	readIFD(order.Uint32(b[4:8]))
+}
+
+// XMP
+
+// readXMP reads the simple properties of an XMP packet, whether written as elements or as attributes of rdf:Description. Array properties, such as dc:subject, are joined with commas.
+func (m *metadataReader) readXMP(b []byte) {
+	if m.xmp == nil {
+		m.xmp = make(map[string]string)
+	}
+	d := xml.NewDecoder(bytes.NewReader(b))
+	prefixes := map[string]string{}
+	var stack []string
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			for _, a := range t.Attr {
+				if a.Name.Space == "xmlns" {
+					prefixes[a.Value] = a.Name.Local
+				}
+			}
+			name := xmpName(prefixes, t.Name)
+			if name == "rdf:Description" {
+				for _, a := range t.Attr {
+					if a.Name.Space != "xmlns" && a.Name.Space != "" {
+						if n := xmpName(prefixes, a.Name); !strings.HasPrefix(n, "rdf:") {
+							m.xmp[n] = a.Value
+						}
+					}
+				}
+			}
+			stack = append(stack, name)
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			text := strings.TrimSpace(string(t))
+			if text == "" || len(stack) == 0 {
+				continue
+			}
+			// Properties are either direct children of rdf:Description or hold an rdf container of rdf:li items.
+			prop := ""
+			for i := len(stack) - 1; i >= 0; i-- {
+				if !strings.HasPrefix(stack[i], "rdf:") && !strings.HasPrefix(stack[i], "x:") {
+					prop = stack[i]
+					break
+				}
+			}
+			if prop == "" {
+				continue
+			}
+			if stack[len(stack)-1] == "rdf:li" && m.xmp[prop] != "" {
+				m.xmp[prop] += ", " + text
+			} else {
+				m.xmp[prop] = text
+			}
+		}
+	}
+}
+
+// xmpName returns the conventional prefixed name of the given XML name, whose space is a namespace URI.
+func xmpName(prefixes map[string]string, n xml.Name) string {
+	if p, ok := prefixes[n.Space]; ok {
+		return p + ":" + n.Local
+	}
+	if n.Space == "" {
+		return n.Local
+	}
+	return n.Space + ":" + n.Local
+}
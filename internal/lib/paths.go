@@ -0,0 +1,132 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+// NotADirectoryError is returned when a directory is relocated to a path that is not a directory.
+type NotADirectoryError struct {
+	path string
+}
+
+func (e *NotADirectoryError) Error() string {
+	return fmt.Sprintf("'%s' is not a directory", e.path)
+}
+
+// projectFile is how a project is stored. Directory paths are written relative to the project file if their directory asks for it, and all paths use `/` so that the file can be moved between systems.
+type projectFile struct {
+	Title       string      `yaml:"Title"`
+	Path        string      `yaml:"Path"`
+	Directories []Directory `yaml:"Directories"`
+	TagRegistry TagRegistry `yaml:"TagRegistry,omitempty"`
+}
+
+// MarshalYAML writes the project in its stored form.
+func (p *Project) MarshalYAML() (interface{}, error) {
+	f := projectFile{
+		Title:       p.Title,
+		Path:        p.Path,
+		TagRegistry: p.TagRegistry,
+	}
+	for _, d := range p.Directories {
+		if d.Relative {
+			if rel, err := filepath.Rel(filepath.Dir(p.Path), d.Path); err == nil {
+				d.Path = rel
+			}
+		}
+		d.Path = filepath.ToSlash(d.Path)
+		f.Directories = append(f.Directories, d)
+	}
+	return f, nil
+}
+
+// resolvePaths makes the project's path absolute and resolves the stored directory paths against it. Directories stored with relative paths are marked as Relative so that they are saved the same way.
+func (p *Project) resolvePaths() {
+	if abs, err := filepath.Abs(p.Path); err == nil {
+		p.Path = abs
+	}
+	for i := range p.Directories {
+		d := &p.Directories[i]
+		d.Path = filepath.FromSlash(d.Path)
+		if !filepath.IsAbs(d.Path) {
+			d.Path = filepath.Join(filepath.Dir(p.Path), d.Path)
+			d.Relative = true
+		}
+	}
+}
+
+// directoryEntryYAML has the fields of DirectoryEntry without its YAML methods.
+type directoryEntryYAML DirectoryEntry
+
+// MarshalYAML writes the entry with its path separated by `/`.
+func (e DirectoryEntry) MarshalYAML() (interface{}, error) {
+	e.Path = filepath.ToSlash(e.Path)
+	return directoryEntryYAML(e), nil
+}
+
+// UnmarshalYAML reads the entry, converting its path to use the system's separator.
+func (e *DirectoryEntry) UnmarshalYAML(value *yaml.Node) error {
+	if err := value.Decode((*directoryEntryYAML)(e)); err != nil {
+		return err
+	}
+	e.Path = filepath.FromSlash(e.Path)
+	return nil
+}
+
+// SetDirectoryRelative sets if the given directory's path is saved relative to the project file.
+func (p *Project) SetDirectoryRelative(u uuid.UUID, relative bool) error {
+	var current bool
+	if err := p.readDirectory(u, func(d *Directory) { current = d.Relative }); err != nil {
+		return err
+	}
+	if current == relative {
+		return nil
+	}
+	p.apply(&SetDirectoryRelativeAction{
+		UUID:     u,
+		Relative: relative,
+	})
+	return nil
+}
+
+// RelocateDirectory points the given directory at a new root as an undoable action, keeping all of its entries as they are. Syncing afterwards marks any entries that are not in the new root as missing.
+func (p *Project) RelocateDirectory(u uuid.UUID, path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	p.mutex.RLock()
+	d, err := p.GetDirectoryByUUID(u)
+	if err != nil {
+		p.mutex.RUnlock()
+		return err
+	}
+	if d.Path == path {
+		p.mutex.RUnlock()
+		return nil
+	}
+	for _, d2 := range p.Directories {
+		if d2.Path == path {
+			p.mutex.RUnlock()
+			return &DirectoryExistsError{path}
+		}
+	}
+	p.mutex.RUnlock()
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return &NotADirectoryError{path}
+	}
+	p.apply(&RelocateDirectoryAction{
+		UUID: u,
+		Path: path,
+	})
+	return nil
+}
@@ -0,0 +1,371 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"math/bits"
+	"mime"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/image/draw"
+	"gopkg.in/yaml.v3"
+)
+
+// Perceptual hash methods.
+const (
+	PerceptualAverage    = "aHash"
+	PerceptualDifference = "dHash"
+	PerceptualDCT        = "pHash"
+)
+
+// PerceptualHashes are the perceptual hashes of an image. Visually similar images have hashes that differ by few bits.
+type PerceptualHashes struct {
+	AHash uint64 `json:"AHash" yaml:"AHash"`
+	DHash uint64 `json:"DHash" yaml:"DHash"`
+	PHash uint64 `json:"PHash" yaml:"PHash"`
+}
+
+// Distance returns the Hamming distance between the hashes of the given method.
+func (h PerceptualHashes) Distance(o PerceptualHashes, method string) int {
+	switch method {
+	case PerceptualAverage:
+		return bits.OnesCount64(h.AHash ^ o.AHash)
+	case PerceptualDifference:
+		return bits.OnesCount64(h.DHash ^ o.DHash)
+	}
+	return bits.OnesCount64(h.PHash ^ o.PHash)
+}
+
+// UnknownPerceptualMethodError is returned when a perceptual hash method does not exist.
+type UnknownPerceptualMethodError struct {
+	method string
+}
+
+func (e *UnknownPerceptualMethodError) Error() string {
+	return fmt.Sprintf("unknown perceptual hash method '%s'", e.method)
+}
+
+// ComputePerceptualHashes computes the perceptual hashes of the given image.
+func ComputePerceptualHashes(img image.Image) PerceptualHashes {
+	var h PerceptualHashes
+
+	// aHash: each bit is whether a pixel of an 8x8 reduction is brighter than the mean.
+	small := grayscale(img, 8, 8)
+	var mean float64
+	for _, v := range small {
+		mean += v
+	}
+	mean /= float64(len(small))
+	for i, v := range small {
+		if v > mean {
+			h.AHash |= 1 << uint(i)
+		}
+	}
+
+	// dHash: each bit is whether a pixel of a 9x8 reduction is brighter than its right neighbour.
+	wide := grayscale(img, 9, 8)
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if wide[y*9+x] > wide[y*9+x+1] {
+				h.DHash |= 1 << uint(y*8+x)
+			}
+		}
+	}
+
+	// pHash: each bit is whether a low frequency of a 32x32 reduction's DCT is above the median.
+	const n = 32
+	large := grayscale(img, n, n)
+	dct := dct2(large, n)
+	var low []float64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			low = append(low, dct[y*n+x])
+		}
+	}
+	// The DC term only reflects overall brightness, so leave it out of the median.
+	sorted := append([]float64(nil), low[1:]...)
+	sort.Float64s(sorted)
+	// With the DC term left out there are 63 values, so the median is the middle one.
+	median := sorted[len(sorted)/2]
+	for i, v := range low {
+		if v > median {
+			h.PHash |= 1 << uint(i)
+		}
+	}
+
+	return h
+}
+
+// grayscale reduces the image to the given size, composited over white, and returns its luminance.
+func grayscale(img image.Image, w, h int) []float64 {
+	dst := image.NewGray(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.BiLinear.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Over, nil)
+	values := make([]float64, w*h)
+	for i, v := range dst.Pix {
+		values[i] = float64(v)
+	}
+	return values
+}
+
+// dct2 returns the two-dimensional type-II DCT of the given n*n values.
+func dct2(values []float64, n int) []float64 {
+	cos := make([]float64, n*n)
+	for k := 0; k < n; k++ {
+		for i := 0; i < n; i++ {
+			cos[k*n+i] = math.Cos(math.Pi / float64(n) * (float64(i) + 0.5) * float64(k))
+		}
+	}
+	rows := make([]float64, n*n)
+	for y := 0; y < n; y++ {
+		for k := 0; k < n; k++ {
+			var sum float64
+			for x := 0; x < n; x++ {
+				sum += values[y*n+x] * cos[k*n+x]
+			}
+			rows[y*n+k] = sum
+		}
+	}
+	out := make([]float64, n*n)
+	for x := 0; x < n; x++ {
+		for k := 0; k < n; k++ {
+			var sum float64
+			for y := 0; y < n; y++ {
+				sum += rows[y*n+x] * cos[k*n+y]
+			}
+			out[k*n+x] = sum
+		}
+	}
+	return out
+}
+
+// PerceptualHashFile decodes the given image file and computes its perceptual hashes.
+func PerceptualHashFile(path string) (PerceptualHashes, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return PerceptualHashes{}, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return PerceptualHashes{}, err
+	}
+	return ComputePerceptualHashes(img), nil
+}
+
+// PerceptualIndexEntry is the perceptual hashes of a file as of the given size and modification time.
+type PerceptualIndexEntry struct {
+	Size    int64            `yaml:"Size"`
+	ModTime time.Time        `yaml:"ModTime"`
+	Hashes  PerceptualHashes `yaml:"Hashes"`
+}
+
+// PerceptualIndex is a persistent index of perceptual hashes keyed by absolute file path.
+type PerceptualIndex struct {
+	path    string
+	mutex   sync.Mutex
+	changed bool
+	Entries map[string]PerceptualIndexEntry `yaml:"Entries"`
+}
+
+// LoadPerceptualIndex loads the perceptual index at the given path. A missing index is treated as empty.
+func LoadPerceptualIndex(path string) (*PerceptualIndex, error) {
+	x := &PerceptualIndex{
+		path:    path,
+		Entries: make(map[string]PerceptualIndexEntry),
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return x, nil
+		}
+		return nil, err
+	}
+	if err := yaml.Unmarshal(b, x); err != nil {
+		return nil, err
+	}
+	if x.Entries == nil {
+		x.Entries = make(map[string]PerceptualIndexEntry)
+	}
+	return x, nil
+}
+
+// Hashes returns the perceptual hashes of the given file, computing them only if the file is not indexed or has changed since.
+func (x *PerceptualIndex) Hashes(path string) (PerceptualHashes, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return PerceptualHashes{}, err
+	}
+
+	x.mutex.Lock()
+	e, ok := x.Entries[path]
+	x.mutex.Unlock()
+	if ok && e.Size == info.Size() && e.ModTime.Equal(info.ModTime()) {
+		return e.Hashes, nil
+	}
+
+	h, err := PerceptualHashFile(path)
+	if err != nil {
+		return PerceptualHashes{}, err
+	}
+
+	x.mutex.Lock()
+	x.Entries[path] = PerceptualIndexEntry{
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Hashes:  h,
+	}
+	x.changed = true
+	x.mutex.Unlock()
+	return h, nil
+}
+
+// Save writes the index to disk if it has changed, dropping any files that no longer exist.
+func (x *PerceptualIndex) Save() error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if !x.changed {
+		return nil
+	}
+	for p := range x.Entries {
+		if _, err := os.Stat(p); errors.Is(err, os.ErrNotExist) {
+			delete(x.Entries, p)
+		}
+	}
+	b, err := yaml.Marshal(x)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(x.path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(x.path, b, 0644); err != nil {
+		return err
+	}
+	x.changed = false
+	return nil
+}
+
+// GetPerceptualIndexPath returns the path of the perceptual index within the user cache directory.
+func GetPerceptualIndexPath() (string, error) {
+	s, err := GetCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s, "perceptual.yml"), nil
+}
+
+// DefaultSimilarThreshold is the Hamming distance used when SimilarOptions has no Threshold.
+const DefaultSimilarThreshold = 10
+
+// SimilarOptions configures a search for visually similar images.
+type SimilarOptions struct {
+	Method    string `json:"Method"`    // should be aHash, dHash, or pHash. Defaults to pHash.
+	Threshold *int   `json:"Threshold"` // Threshold is the greatest Hamming distance, out of 64, that counts as similar. Defaults to DefaultSimilarThreshold if nil, so that 0 finds only identical hashes.
+}
+
+// SimilarMatch is an entry found to be visually similar to another.
+type SimilarMatch struct {
+	Directory uuid.UUID       `json:"Directory"`
+	Entry     *DirectoryEntry `json:"Entry"`
+	Distance  int             `json:"Distance"`
+}
+
+// similarCandidate is an image entry to compare against the target, copied out of the project so that it can be hashed without holding the lock.
+type similarCandidate struct {
+	directory uuid.UUID
+	path      string
+	fullPath  string
+	hashes    PerceptualHashes
+	err       error
+}
+
+// FindSimilar returns the image entries across all directories that are visually similar to the target entry, ranked from most to least similar. The images are hashed without holding the project lock, and the returned entries are copies.
+func (p *Project) FindSimilar(index *PerceptualIndex, target EntryRef, opts SimilarOptions) ([]SimilarMatch, error) {
+	switch opts.Method {
+	case "":
+		opts.Method = PerceptualDCT
+	case PerceptualAverage, PerceptualDifference, PerceptualDCT:
+	default:
+		return nil, &UnknownPerceptualMethodError{opts.Method}
+	}
+	threshold := DefaultSimilarThreshold
+	if opts.Threshold != nil {
+		threshold = *opts.Threshold
+	}
+
+	dirPath, _, err := p.entryCopy(target.Directory, target.Path)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []similarCandidate
+	p.mutex.RLock()
+	for i := range p.Directories {
+		d := &p.Directories[i]
+		for _, e := range d.Entries {
+			if e.Missing || (d.UUID == target.Directory && e.Path == target.Path) {
+				continue
+			}
+			if !strings.HasPrefix(mime.TypeByExtension(filepath.Ext(e.Path)), "image") {
+				continue
+			}
+			candidates = append(candidates, similarCandidate{
+				directory: d.UUID,
+				path:      e.Path,
+				fullPath:  filepath.Join(d.Path, e.Path),
+			})
+		}
+	}
+	p.mutex.RUnlock()
+
+	h, err := index.Hashes(filepath.Join(dirPath, target.Path))
+	if err != nil {
+		return nil, err
+	}
+	for i := range candidates {
+		candidates[i].hashes, candidates[i].err = index.Hashes(candidates[i].fullPath)
+	}
+
+	matches := make([]SimilarMatch, 0)
+	p.mutex.RLock()
+	for _, c := range candidates {
+		if c.err != nil {
+			continue
+		}
+		distance := h.Distance(c.hashes, opts.Method)
+		if distance > threshold {
+			continue
+		}
+		// Entries removed while hashing are left out.
+		d, err := p.GetDirectoryByUUID(c.directory)
+		if err != nil {
+			continue
+		}
+		e := d.Entry(c.path)
+		if e == nil {
+			continue
+		}
+		e2 := e.Clone()
+		matches = append(matches, SimilarMatch{
+			Directory: c.directory,
+			Entry:     &e2,
+			Distance:  distance,
+		})
+	}
+	p.mutex.RUnlock()
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Distance < matches[j].Distance
+	})
+	return matches, nil
+}
@@ -1,8 +1,11 @@
 package lib
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"os"
+	"sync"
 	"treesource/internal/do"
 
 	"github.com/google/uuid"
@@ -10,12 +13,17 @@ import (
 
 // Project represents a full treesource project.
 type Project struct {
-	Emitter     `json:"-" yaml:"-"`
-	Title       string      `json:"Title" yaml:"Title"`             // Title of the project.
-	Path        string      `json:"Path" yaml:"Path"`               // Path from which the project file was read and should be saved to.
-	Directories []Directory `json:"Directories" yaml:"Directories"` // Directories to pull from as sources.
-	changed     bool
-	history     do.History[*Project]
+	Emitter        `json:"-" yaml:"-"`
+	Title          string      `json:"Title" yaml:"Title"`                       // Title of the project.
+	Path           string      `json:"Path" yaml:"Path"`                         // Path from which the project file was read and should be saved to.
+	Directories    []Directory `json:"Directories" yaml:"Directories"`           // Directories to pull from as sources.
+	TagRegistry    TagRegistry `json:"TagRegistry" yaml:"TagRegistry,omitempty"` // TagRegistry holds tag aliases and implications.
+	changed        bool
+	history        do.History[*Project]
+	watchers       map[uuid.UUID]*directoryWatcher
+	directoryIndex map[uuid.UUID]int // directoryIndex maps UUIDs to indices of Directories.
+	mutex          sync.RWMutex      // mutex guards Directories and their entries. Syncs, watchers, and history actions hold it while changing them, and readers hold it for reading.
+	after          []func()          // after holds work queued by actions to run once mutex is released, such as syncing an added directory.
 }
 
 func NewProject() *Project {
@@ -41,6 +49,95 @@ func (p *Project) Unchange() {
 	p.changed = false
 }
 
+// RLock locks the project's directories and entries for reading. Anything reading them outside of the project's own methods, such as a user interface, must hold it, and must not call back into the project while doing so.
+func (p *Project) RLock() {
+	p.mutex.RLock()
+}
+
+// RUnlock undoes a single RLock call.
+func (p *Project) RUnlock() {
+	p.mutex.RUnlock()
+}
+
+// unlock releases the write lock, then runs any work queued by actions while it was held.
+func (p *Project) unlock() {
+	after := p.after
+	p.after = nil
+	p.mutex.Unlock()
+	for _, f := range after {
+		f()
+	}
+}
+
+// runAfter queues f to run once the write lock is released. It must only be called while holding it, such as from an action.
+func (p *Project) runAfter(f func()) {
+	p.after = append(p.after, f)
+}
+
+// apply pushes and applies the given action while holding the write lock.
+func (p *Project) apply(a do.Action[*Project]) {
+	p.mutex.Lock()
+	p.history.PushAndApply(a)
+	p.unlock()
+}
+
+// Undo unapplies the last applied action.
+func (p *Project) Undo() {
+	p.mutex.Lock()
+	p.history.Undo()
+	p.unlock()
+}
+
+// Redo reapplies the last undone action.
+func (p *Project) Redo() {
+	p.mutex.Lock()
+	p.history.Redo()
+	p.unlock()
+}
+
+// Undoable returns if there is an action to undo.
+func (p *Project) Undoable() bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.history.Undoable()
+}
+
+// Redoable returns if there is an action to redo.
+func (p *Project) Redoable() bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.history.Redoable()
+}
+
+// Unsaved returns if actions were applied or undone since the project was last saved.
+func (p *Project) Unsaved() bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.history.SavedPos != p.history.Pos
+}
+
+// markSaved marks the current point in the history as saved.
+func (p *Project) markSaved() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.history.SavedPos = p.history.Pos
+}
+
+// Snapshot returns a copy of the project's title, path, directories, and tag registry, read while holding the read lock, so that it can be handed to a user interface.
+func (p *Project) Snapshot() *Project {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	p2 := &Project{
+		Title:       p.Title,
+		Path:        p.Path,
+		TagRegistry: p.TagRegistry.Clone(),
+	}
+	for i := range p.Directories {
+		p2.Directories = append(p2.Directories, *p.Directories[i].Clone())
+	}
+	return p2
+}
+
 type DirectoryExistsError struct {
 	dir string
 }
@@ -51,11 +148,15 @@ func (e *DirectoryExistsError) Error() string {
 
 func (p *Project) AddDirectory(name string, ignoreDot bool) error {
 	// Do not add a directory if it already exists.
+	p.mutex.RLock()
 	for _, d := range p.Directories {
 		if d.Path == name {
+			p.mutex.RUnlock()
 			return &DirectoryExistsError{name}
 		}
 	}
+	index := len(p.Directories)
+	p.mutex.RUnlock()
 
 	d := Directory{
 		UUID:       uuid.New(),
@@ -71,41 +172,244 @@ func (p *Project) AddDirectory(name string, ignoreDot bool) error {
 		panic(err)
 	}*/
 
-	p.history.PushAndApply(&AddDirectoryAction{
-		Index:     len(p.Directories),
+	p.apply(&AddDirectoryAction{
+		Index:     index,
 		Directory: *d.Clone(),
 	})
 
+	p.mutex.Lock()
 	p.changed = true
+	p.mutex.Unlock()
 
 	return nil
 }
 
+// InitDirectory hooks, syncs, and watches the project's directory of the same UUID as d.
 func (p *Project) InitDirectory(d *Directory) error {
+	u := d.UUID
+	p.mutex.Lock()
+	d, err := p.GetDirectoryByUUID(u)
+	if err != nil {
+		p.mutex.Unlock()
+		return err
+	}
+	p.hookDirectory(d)
+	syncOnLoad := d.SyncOnLoad
+	p.mutex.Unlock()
+	if syncOnLoad {
+		if err := p.syncDirectory(context.Background(), u); err != nil {
+			return err
+		}
+	}
+	p.mutex.Lock()
+	if d, err := p.GetDirectoryByUUID(u); err == nil {
+		p.watchDirectory(d)
+	}
+	p.mutex.Unlock()
+	return nil
+}
+
+// initDirectoryAfter initializes a directory added by an action. The directory is hooked straight away, but as syncing takes the write lock itself, it is synced, watched, and has its entries emitted once the lock is released.
+func (p *Project) initDirectoryAfter(u uuid.UUID) {
+	d, err := p.GetDirectoryByUUID(u)
+	if err != nil {
+		return
+	}
+	p.hookDirectory(d)
+	p.runAfter(func() {
+		var syncOnLoad bool
+		if err := p.readDirectory(u, func(d *Directory) { syncOnLoad = d.SyncOnLoad }); err != nil {
+			return
+		}
+		if syncOnLoad {
+			p.syncDirectory(context.Background(), u)
+		}
+		p.mutex.Lock()
+		if d, err := p.GetDirectoryByUUID(u); err == nil {
+			p.watchDirectory(d)
+		}
+		p.mutex.Unlock()
+		// Seems reasonable enough to emit all entries on load.
+		p.mutex.RLock()
+		if d, err := p.GetDirectoryByUUID(u); err == nil {
+			d.EmitAllEntries()
+		}
+		p.mutex.RUnlock()
+	})
+}
+
+// InitDirectories initializes every directory as InitDirectory does, but syncs them concurrently.
+func (p *Project) InitDirectories(ctx context.Context) error {
+	var uuids []uuid.UUID
+	p.mutex.Lock()
+	for i := range p.Directories {
+		d := &p.Directories[i]
+		p.hookDirectory(d)
+		if d.SyncOnLoad {
+			uuids = append(uuids, d.UUID)
+		}
+	}
+	p.mutex.Unlock()
+	err := p.SyncDirectories(ctx, uuids)
+	p.mutex.Lock()
+	for i := range p.Directories {
+		p.watchDirectory(&p.Directories[i])
+	}
+	p.mutex.Unlock()
+	return err
+}
+
+// hookDirectory re-emits the directory's events from the project.
+func (p *Project) hookDirectory(d *Directory) {
 	d.On("sync", p.SyncDirectoryCallback)
+	d.On("progress", p.SyncProgressCallback)
 	d.On("synced", p.SyncedDirectoryCallback)
 	d.On("entry", p.EntryCallback)
 	d.On("add", p.EntryAddCallback)
 	d.On(EventDirectoryEntryRemove, p.EntryRemoveCallback)
 	d.On(EventDirectoryEntryUpdate, p.EntryUpdateCallback)
 	d.On("found", p.EntryFoundCallback)
+	d.On("move", p.EntryMoveCallback)
+	d.On("change", p.EntryChangeCallback)
 	d.On("missing", p.EntryMissingCallback)
 
 	d.Separator = string(os.PathSeparator)
+}
 
-	if d.SyncOnLoad {
-		err := d.SyncEntries()
-		if err != nil {
+// watchDirectory starts watching the directory if it should be watched.
+func (p *Project) watchDirectory(d *Directory) {
+	if d.Watch {
+		if err := p.StartWatching(d); err != nil {
+			p.Emit(EventDirectoryWatch, DirectoryWatchEvent{
+				UUID:  d.UUID,
+				Error: err,
+			})
+		}
+	}
+}
+
+// SyncDirectories syncs the given directories concurrently, stopping early if ctx is canceled. The errors of every directory are returned together.
+func (p *Project) SyncDirectories(ctx context.Context, uuids []uuid.UUID) error {
+	p.mutex.RLock()
+	for _, u := range uuids {
+		if _, err := p.GetDirectoryByUUID(u); err != nil {
+			p.mutex.RUnlock()
 			return err
 		}
 	}
+	p.mutex.RUnlock()
+
+	errs := make([]error, len(uuids))
+	var wg sync.WaitGroup
+	for i, u := range uuids {
+		wg.Add(1)
+		go func(i int, u uuid.UUID) {
+			defer wg.Done()
+			errs[i] = p.syncDirectory(ctx, u)
+		}(i, u)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var errors []error
+	for _, err := range errs {
+		if err != nil {
+			errors = append(errors, err)
+		}
+	}
+	if len(errors) > 0 {
+		return &SyncError{errors}
+	}
+	return nil
+}
+
+// SetDirectoryWatch enables or disables watching the given directory for changes.
+func (p *Project) SetDirectoryWatch(u uuid.UUID, watch bool) error {
+	var watching bool
+	if err := p.readDirectory(u, func(d *Directory) { watching = d.Watch }); err != nil {
+		return err
+	}
+	if watching == watch {
+		return nil
+	}
+	p.apply(&SetDirectoryWatchAction{
+		UUID:  u,
+		Watch: watch,
+	})
+	return nil
+}
+
+// SetDirectoryFollowLinks sets if symlinked directories are synced as part of the given directory. The change takes effect on the next sync.
+func (p *Project) SetDirectoryFollowLinks(u uuid.UUID, follow bool) error {
+	var following bool
+	if err := p.readDirectory(u, func(d *Directory) { following = d.FollowLinks }); err != nil {
+		return err
+	}
+	if following == follow {
+		return nil
+	}
+	p.apply(&SetDirectoryFollowLinksAction{
+		UUID:        u,
+		FollowLinks: follow,
+	})
+	return nil
+}
+
+// reindex rebuilds the UUID index from Directories. It must be called whenever directories are added or removed.
+func (p *Project) reindex() {
+	p.directoryIndex = make(map[uuid.UUID]int, len(p.Directories))
+	for i := range p.Directories {
+		p.directoryIndex[p.Directories[i].UUID] = i
+	}
+}
+
+// readDirectory calls f with the directory of the given UUID while holding the read lock.
+func (p *Project) readDirectory(u uuid.UUID, f func(d *Directory)) error {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	d, err := p.GetDirectoryByUUID(u)
+	if err != nil {
+		return err
+	}
+	f(d)
 	return nil
 }
 
+// entryCopy returns the path of the given directory along with a copy of its entry at the given path, read while holding the read lock.
+func (p *Project) entryCopy(u uuid.UUID, path string) (string, DirectoryEntry, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	d, err := p.GetDirectoryByUUID(u)
+	if err != nil {
+		return "", DirectoryEntry{}, err
+	}
+	e := d.Entry(path)
+	if e == nil {
+		return "", DirectoryEntry{}, &MissingEntryError{
+			dir:  d.Path,
+			path: path,
+		}
+	}
+	return d.Path, e.Clone(), nil
+}
+
+// tagRegistry returns the current tag registry. Its maps are replaced rather than changed by SetTagRegistryAction, so they may be read once returned.
+func (p *Project) tagRegistry() TagRegistry {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.TagRegistry
+}
+
+// GetDirectoryByUUID returns the directory with the given UUID. Directories are searched directly should the UUID index not agree with them.
 func (p *Project) GetDirectoryByUUID(u uuid.UUID) (*Directory, error) {
-	for _, d := range p.Directories {
-		if u.String() == d.UUID.String() {
-			return &d, nil
+	if i, ok := p.directoryIndex[u]; ok && i < len(p.Directories) && p.Directories[i].UUID == u {
+		return &p.Directories[i], nil
+	}
+	for i := range p.Directories {
+		if p.Directories[i].UUID == u {
+			return &p.Directories[i], nil
 		}
 	}
 	return nil, &MissingDirectoryError{
@@ -114,15 +418,19 @@ func (p *Project) GetDirectoryByUUID(u uuid.UUID) (*Directory, error) {
 }
 
 func (p *Project) RemoveDirectoryByUUID(UUID uuid.UUID) error {
+	p.mutex.RLock()
 	for i, d := range p.Directories {
 		if UUID.String() == d.UUID.String() {
-			p.history.PushAndApply(&RemoveDirectoryAction{
+			action := &RemoveDirectoryAction{
 				Directory: *d.Clone(),
 				Index:     i,
-			})
+			}
+			p.mutex.RUnlock()
+			p.apply(action)
 			return nil
 		}
 	}
+	p.mutex.RUnlock()
 	return &MissingDirectoryError{}
 }
 
@@ -131,8 +439,10 @@ func (p *Project) UpdateDirectoryEntry(u uuid.UUID, path string, entry Directory
 	if err != nil {
 		return err
 	}*/
-	fmt.Println("push and apply", u, path, entry)
-	p.history.PushAndApply(&UpdateEntryAction{
+	registry := p.tagRegistry()
+	entry.Tags = registry.Apply(entry.Tags)
+	log.Println("push and apply", u, path, entry)
+	p.apply(&UpdateEntryAction{
 		UUID:  u,
 		path:  path,
 		Entry: entry,
@@ -146,29 +456,61 @@ func (p *Project) UpdateDirectoryEntry(u uuid.UUID, path string, entry Directory
 }
 
 func (p *Project) SyncDirectory(name string) error {
-	for _, d := range p.Directories {
-		if d.Path == name {
-			err := d.SyncEntries()
-			if err != nil {
-				return err
-			}
-			return nil
+	p.mutex.RLock()
+	for i := range p.Directories {
+		if p.Directories[i].Path == name {
+			u := p.Directories[i].UUID
+			p.mutex.RUnlock()
+			return p.syncDirectory(context.Background(), u)
 		}
 	}
+	p.mutex.RUnlock()
 	return &MissingDirectoryError{
 		dir: name,
 	}
 }
 
+// syncDirectory syncs the directory of the given UUID. Its settings are copied under the read lock and its file structure is read without holding any lock. The directory is then found again by its UUID to apply the results under the write lock, which are dropped if it was removed in the meantime.
+func (p *Project) syncDirectory(ctx context.Context, u uuid.UUID) error {
+	p.mutex.RLock()
+	d, err := p.GetDirectoryByUUID(u)
+	if err != nil {
+		p.mutex.RUnlock()
+		return err
+	}
+	settings, known := d.settings(), d.knownEntries()
+	p.mutex.RUnlock()
+
+	scan, err := settings.scanEntries(ctx, known)
+	if err != nil {
+		return err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if d, err = p.GetDirectoryByUUID(u); err != nil {
+		settings.Emit("synced", &DirectorySyncedEvent{
+			UUID:  u,
+			Error: err,
+		})
+		return err
+	}
+	return d.applyScan(scan)
+}
+
 //
 
 func (p *Project) SyncDirectoryCallback(e Event) {
-	fmt.Println(EventDirectorySync, e)
+	log.Println(EventDirectorySync, e)
 	p.Emit(EventDirectorySync, e)
 }
 
+func (p *Project) SyncProgressCallback(e Event) {
+	p.Emit(EventDirectorySyncProgress, e)
+}
+
 func (p *Project) SyncedDirectoryCallback(e Event) {
-	fmt.Println(EventDirectorySynced, e)
+	log.Println(EventDirectorySynced, e)
 	p.Emit(EventDirectorySynced, e)
 }
 
@@ -193,12 +535,22 @@ func (p *Project) EntryUpdateCallback(e Event) {
 
 func (p *Project) EntryMissingCallback(e Event) {
 	p.Changed()
-	fmt.Println(EventDirectoryEntryMissing, e)
+	log.Println(EventDirectoryEntryMissing, e)
 	p.Emit(EventDirectoryEntryMissing, e)
 }
 
+func (p *Project) EntryMoveCallback(e Event) {
+	p.Changed()
+	p.Emit(EventDirectoryEntryMove, e)
+}
+
+func (p *Project) EntryChangeCallback(e Event) {
+	p.Changed()
+	p.Emit(EventDirectoryEntryChange, e)
+}
+
 func (p *Project) EntryFoundCallback(e Event) {
 	p.Changed()
-	fmt.Println(EventDirectoryEntryFound, e)
+	log.Println(EventDirectoryEntryFound, e)
 	p.Emit(EventDirectoryEntryFound, e)
 }
@@ -0,0 +1,470 @@
+package lib
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Query is a parsed tag query expression, such as `(character AND idle) OR npc NOT wip`.
+//
+// Terms are tags, which may contain `*` wildcards and match hierarchical tags by any of their parents, or one of the following:
+//
+//	rating>=3         compare the entry's rating using =, !=, <, <=, >, or >=
+//	missing:true      match entries that are or are not missing
+//	dir:<uuid>        match entries within the given directory
+//	path:<pattern>    match entries whose path matches the pattern or is beneath it
+//
+// Terms may be combined with AND, OR, and NOT, and grouped with parentheses. Adjacent terms are implicitly ANDed.
+//
+// Double quotes keep spaces, parentheses, and keywords within a term, and `\"` and `\\` within them are a literal quote and backslash. A term that begins with a quote is always a tag, matched without wildcards.
+type Query struct {
+	Source string
+	root   queryNode
+}
+
+// QueryParseError is returned when a query expression is malformed.
+type QueryParseError struct {
+	Query    string `json:"Query"`
+	Position int    `json:"Position"` // Position is the byte offset into Query where the problem was found.
+	Message  string `json:"Message"`
+}
+
+func (e *QueryParseError) Error() string {
+	return fmt.Sprintf("query error at %d: %s", e.Position, e.Message)
+}
+
+// QueryMatch is an entry matched by a query. Entry is a copy, so it may be read without holding the project lock.
+type QueryMatch struct {
+	Directory uuid.UUID       `json:"Directory"`
+	Entry     *DirectoryEntry `json:"Entry"`
+}
+
+// ParseQuery parses the given query expression. An empty expression matches every entry.
+func ParseQuery(s string) (*Query, error) {
+	tokens, err := lexQuery(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{
+		source: s,
+		tokens: tokens,
+	}
+	q := &Query{
+		Source: s,
+	}
+	if p.peek().kind == queryTokenEnd {
+		q.root = &queryAll{}
+		return q, nil
+	}
+	if q.root, err = p.parseOr(); err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != queryTokenEnd {
+		return nil, p.errorf(t, "unexpected '%s'", t.text)
+	}
+	return q, nil
+}
+
+// Match returns if the given entry within the given directory matches the query. If registry is not nil, its aliases and implications are applied to both the query's tags and the entry's tags.
+func (q *Query) Match(registry *TagRegistry, d *Directory, e *DirectoryEntry) bool {
+	t := &queryTarget{
+		registry: registry,
+		dir:      d,
+		entry:    e,
+		tags:     e.Tags,
+	}
+	if registry != nil {
+		t.tags = registry.Apply(e.Tags)
+	}
+	return q.root.match(t)
+}
+
+// Query returns copies of every entry across all directories that matches the given query.
+func (p *Project) Query(q *Query) []QueryMatch {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	matches := make([]QueryMatch, 0)
+	for i := range p.Directories {
+		d := &p.Directories[i]
+		for _, e := range d.Entries {
+			if q.Match(&p.TagRegistry, d, e) {
+				e2 := e.Clone()
+				matches = append(matches, QueryMatch{
+					Directory: d.UUID,
+					Entry:     &e2,
+				})
+			}
+		}
+	}
+	return matches
+}
+
+// Lexing
+
+type queryTokenKind int
+
+const (
+	queryTokenEnd queryTokenKind = iota
+	queryTokenWord
+	queryTokenAnd
+	queryTokenOr
+	queryTokenNot
+	queryTokenOpen
+	queryTokenClose
+)
+
+type queryToken struct {
+	kind   queryTokenKind
+	text   string
+	pos    int
+	quoted bool
+}
+
+func lexQuery(s string) ([]queryToken, error) {
+	var tokens []queryToken
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case isQuerySpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, queryToken{queryTokenOpen, "(", i, false})
+			i++
+		case c == ')':
+			tokens = append(tokens, queryToken{queryTokenClose, ")", i, false})
+			i++
+		default:
+			start := i
+			var b strings.Builder
+			for i < len(s) && !isQuerySpace(s[i]) && s[i] != '(' && s[i] != ')' {
+				if s[i] == '"' {
+					j := i + 1
+					for ; j < len(s) && s[j] != '"'; j++ {
+						if s[j] == '\\' && j+1 < len(s) && (s[j+1] == '"' || s[j+1] == '\\') {
+							j++
+						}
+						b.WriteByte(s[j])
+					}
+					if j == len(s) {
+						return nil, &QueryParseError{
+							Query:    s,
+							Position: i,
+							Message:  "unterminated quote",
+						}
+					}
+					i = j + 1
+					continue
+				}
+				b.WriteByte(s[i])
+				i++
+			}
+			kind := queryTokenWord
+			switch s[start:i] {
+			case "AND":
+				kind = queryTokenAnd
+			case "OR":
+				kind = queryTokenOr
+			case "NOT":
+				kind = queryTokenNot
+			}
+			tokens = append(tokens, queryToken{kind, b.String(), start, s[start] == '"'})
+		}
+	}
+	tokens = append(tokens, queryToken{queryTokenEnd, "", len(s), false})
+	return tokens, nil
+}
+
+func isQuerySpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// quoteQueryTag returns the given tag as a quoted query term that matches it literally.
+func quoteQueryTag(tag string) string {
+	tag = strings.ReplaceAll(tag, `\`, `\\`)
+	tag = strings.ReplaceAll(tag, `"`, `\"`)
+	return `"` + tag + `"`
+}
+
+// Parsing
+
+type queryParser struct {
+	source string
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() queryToken {
+	t := p.tokens[p.pos]
+	if t.kind != queryTokenEnd {
+		p.pos++
+	}
+	return t
+}
+
+func (p *queryParser) errorf(t queryToken, format string, args ...interface{}) error {
+	return &QueryParseError{
+		Query:    p.source,
+		Position: t.pos,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == queryTokenOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &queryOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch p.peek().kind {
+		case queryTokenAnd:
+			p.next()
+		case queryTokenWord, queryTokenNot, queryTokenOpen:
+			// Implicit AND.
+		default:
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &queryAnd{left, right}
+	}
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	if p.peek().kind == queryTokenNot {
+		p.next()
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &queryNot{n}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *queryParser) parsePrimary() (queryNode, error) {
+	t := p.next()
+	switch t.kind {
+	case queryTokenOpen:
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.next(); c.kind != queryTokenClose {
+			return nil, p.errorf(c, "expected ')'")
+		}
+		return n, nil
+	case queryTokenWord:
+		return p.parseTerm(t)
+	case queryTokenEnd:
+		return nil, p.errorf(t, "unexpected end of query")
+	}
+	return nil, p.errorf(t, "unexpected '%s'", t.text)
+}
+
+func (p *queryParser) parseTerm(t queryToken) (queryNode, error) {
+	if t.quoted {
+		return &queryTag{t.text, true}, nil
+	}
+	if strings.HasPrefix(t.text, "rating") {
+		rest := t.text[len("rating"):]
+		for _, op := range []string{">=", "<=", "!=", "=", ">", "<", ":"} {
+			if strings.HasPrefix(rest, op) {
+				v, err := strconv.ParseFloat(rest[len(op):], 64)
+				if err != nil {
+					return nil, p.errorf(t, "invalid rating '%s'", rest[len(op):])
+				}
+				if op == ":" {
+					op = "="
+				}
+				return &queryRating{op, v}, nil
+			}
+		}
+	}
+	if i := strings.IndexByte(t.text, ':'); i != -1 {
+		value := t.text[i+1:]
+		switch t.text[:i] {
+		case "missing":
+			v, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, p.errorf(t, "invalid missing value '%s'", value)
+			}
+			return &queryMissing{v}, nil
+		case "dir":
+			if value == "" {
+				return nil, p.errorf(t, "missing directory")
+			}
+			return &queryDir{value}, nil
+		case "path":
+			if value == "" {
+				return nil, p.errorf(t, "missing path")
+			}
+			return &queryPath{strings.TrimSuffix(filepath.ToSlash(value), "/")}, nil
+		}
+	}
+	if t.text == "" {
+		return nil, p.errorf(t, "empty tag")
+	}
+	return &queryTag{t.text, false}, nil
+}
+
+// Evaluation
+
+// queryTarget is the entry a query is being matched against.
+type queryTarget struct {
+	registry *TagRegistry
+	dir      *Directory
+	entry    *DirectoryEntry
+	tags     []string // tags are the entry's tags with the registry applied.
+}
+
+type queryNode interface {
+	match(t *queryTarget) bool
+}
+
+type queryAll struct{}
+
+func (n *queryAll) match(t *queryTarget) bool {
+	return true
+}
+
+type queryAnd struct {
+	left, right queryNode
+}
+
+func (n *queryAnd) match(t *queryTarget) bool {
+	return n.left.match(t) && n.right.match(t)
+}
+
+type queryOr struct {
+	left, right queryNode
+}
+
+func (n *queryOr) match(t *queryTarget) bool {
+	return n.left.match(t) || n.right.match(t)
+}
+
+type queryNot struct {
+	node queryNode
+}
+
+func (n *queryNot) match(t *queryTarget) bool {
+	return !n.node.match(t)
+}
+
+type queryTag struct {
+	pattern string
+	literal bool // literal is if the pattern was quoted, and so has no wildcards.
+}
+
+func (n *queryTag) match(t *queryTarget) bool {
+	pattern := n.pattern
+	if t.registry != nil {
+		pattern = t.registry.Canonical(pattern)
+	}
+	for _, tag := range t.tags {
+		// Hierarchical tags also match their parents.
+		for tag != "" {
+			if tag == pattern || (!n.literal && wildcardMatch(pattern, tag)) {
+				return true
+			}
+			tag = TagParent(tag)
+		}
+	}
+	return false
+}
+
+type queryRating struct {
+	op    string
+	value float64
+}
+
+func (n *queryRating) match(t *queryTarget) bool {
+	switch n.op {
+	case ">=":
+		return t.entry.Rating >= n.value
+	case "<=":
+		return t.entry.Rating <= n.value
+	case ">":
+		return t.entry.Rating > n.value
+	case "<":
+		return t.entry.Rating < n.value
+	case "!=":
+		return t.entry.Rating != n.value
+	}
+	return t.entry.Rating == n.value
+}
+
+type queryMissing struct {
+	value bool
+}
+
+func (n *queryMissing) match(t *queryTarget) bool {
+	return t.entry.Missing == n.value
+}
+
+type queryDir struct {
+	value string
+}
+
+func (n *queryDir) match(t *queryTarget) bool {
+	return t.dir != nil && (t.dir.UUID.String() == n.value || t.dir.Path == n.value)
+}
+
+type queryPath struct {
+	pattern string
+}
+
+func (n *queryPath) match(t *queryTarget) bool {
+	p := filepath.ToSlash(t.entry.Path)
+	if strings.ContainsRune(n.pattern, '*') {
+		return wildcardMatch(n.pattern, p)
+	}
+	return p == n.pattern || strings.HasPrefix(p, n.pattern+"/")
+}
+
+// wildcardMatch returns if s matches pattern, where `*` in pattern matches any run of characters.
+func wildcardMatch(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i == -1 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return strings.HasSuffix(s, parts[len(parts)-1])
+}
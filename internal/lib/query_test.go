@@ -0,0 +1,182 @@
+package lib
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestQueryMatch(t *testing.T) {
+	d := &Directory{
+		UUID: uuid.MustParse("6f1c2a4e-8d3b-4c5a-9e7f-0a1b2c3d4e5f"),
+		Path: "/art",
+	}
+	hero := &DirectoryEntry{
+		Path:   "sprites/hero.png",
+		Tags:   []string{"character/hero", "idle"},
+		Rating: 4,
+	}
+	tests := []struct {
+		name  string
+		query string
+		entry *DirectoryEntry
+		want  bool
+	}{
+		{"empty", "", hero, true},
+		{"tag", "idle", hero, true},
+		{"absent tag", "walk", hero, false},
+		{"parent tag", "character", hero, true},
+		{"partial name", "char", hero, false},
+		{"implicit and", "character idle", hero, true},
+		{"implicit and fails", "character walk", hero, false},
+		{"or", "walk OR idle", hero, true},
+		{"and binds tighter than or", "idle OR walk AND npc", hero, true},
+		{"and binds tighter than or on the left", "walk AND npc OR idle", hero, true},
+		{"implicit and binds tighter than or", "walk npc OR idle", hero, true},
+		{"parentheses", "(idle OR walk) AND npc", hero, false},
+		{"not", "NOT walk", hero, true},
+		{"not binds tightest", "NOT idle OR character", hero, true},
+		{"not of group", "NOT (idle OR walk)", hero, false},
+		{"double not", "NOT NOT idle", hero, true},
+		{"wildcard", "char*/h*", hero, true},
+		{"wildcard suffix", "*/hero", hero, true},
+		{"wildcard mismatch", "char*/v*", hero, false},
+		{"quoted", `"idle"`, hero, true},
+		{"quoted keyword", `"AND"`, &DirectoryEntry{Tags: []string{"AND"}}, true},
+		{"quoted space", `"two words"`, &DirectoryEntry{Tags: []string{"two words"}}, true},
+		{"quoted parentheses", `"a (b)"`, &DirectoryEntry{Tags: []string{"a (b)"}}, true},
+		{"quoted escapes", `"say \"hi\" \\o/"`, &DirectoryEntry{Tags: []string{`say "hi" \o/`}}, true},
+		{"quoted has no wildcards", `"char*"`, hero, false},
+		{"quoted star", `"char*"`, &DirectoryEntry{Tags: []string{"char*"}}, true},
+		{"quoted is never a term", `"rating>=3"`, hero, false},
+		{"quotes within a word", `a" b"`, &DirectoryEntry{Tags: []string{"a b"}}, true},
+		{"rating", "rating>=4", hero, true},
+		{"rating greater", "rating>4", hero, false},
+		{"rating not equal", "rating!=3", hero, true},
+		{"rating colon", "rating:4", hero, true},
+		{"missing", "missing:false", hero, true},
+		{"missing true", "missing:true", hero, false},
+		{"dir uuid", "dir:6f1c2a4e-8d3b-4c5a-9e7f-0a1b2c3d4e5f", hero, true},
+		{"dir path", "dir:/art", hero, true},
+		{"other dir", "dir:/music", hero, false},
+		{"path prefix", "path:sprites", hero, true},
+		{"path prefix with slash", "path:sprites/", hero, true},
+		{"path not a prefix", "path:sprite", hero, false},
+		{"path wildcard", "path:*.png", hero, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery(%q) error = %v", tt.query, err)
+			}
+			if got := q.Match(nil, d, tt.entry); got != tt.want {
+				t.Errorf("ParseQuery(%q).Match() = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryMatchRegistry(t *testing.T) {
+	r := &TagRegistry{
+		Aliases: map[string]string{"kitty": "cat"},
+		Implies: map[string][]string{"cat": {"animal"}},
+	}
+	e := &DirectoryEntry{Tags: []string{"kitty"}}
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"cat", true},
+		{"kitty", true},
+		{"animal", true},
+		{"dog", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery(%q) error = %v", tt.query, err)
+			}
+			if got := q.Match(r, nil, e); got != tt.want {
+				t.Errorf("ParseQuery(%q).Match() = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		query    string
+		position int
+		message  string
+	}{
+		{`"idle`, 0, "unterminated quote"},
+		{`idle "walk`, 5, "unterminated quote"},
+		{`"walk\"`, 0, "unterminated quote"},
+		{"idle AND", 8, "unexpected end of query"},
+		{"NOT", 3, "unexpected end of query"},
+		{"OR idle", 0, "unexpected 'OR'"},
+		{"idle OR OR walk", 8, "unexpected 'OR'"},
+		{"(idle", 5, "expected ')'"},
+		{"idle)", 4, "unexpected ')'"},
+		{"()", 1, "unexpected ')'"},
+		{"idle rating>=high", 5, "invalid rating 'high'"},
+		{"missing:maybe", 0, "invalid missing value 'maybe'"},
+		{"dir:", 0, "missing directory"},
+		{"walk path:", 5, "missing path"},
+		{`""`, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := ParseQuery(tt.query)
+			if tt.message == "" {
+				if err != nil {
+					t.Fatalf("ParseQuery(%q) error = %v, want none", tt.query, err)
+				}
+				return
+			}
+			var perr *QueryParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("ParseQuery(%q) error = %v, want a QueryParseError", tt.query, err)
+			}
+			if perr.Position != tt.position || perr.Message != tt.message {
+				t.Errorf("ParseQuery(%q) error at %d %q, want at %d %q", tt.query, perr.Position, perr.Message, tt.position, tt.message)
+			}
+			if perr.Query != tt.query {
+				t.Errorf("ParseQuery(%q) error query = %q", tt.query, perr.Query)
+			}
+		})
+	}
+}
+
+func TestTagsViewExpression(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []string
+	}{
+		{"plain", []string{"idle"}},
+		{"keyword", []string{"OR"}},
+		{"space", []string{"two words"}},
+		{"quote", []string{`say "hi"`}},
+		{"backslash", []string{`back\slash`, `trailing\`}},
+		{"star", []string{"char*"}},
+		{"term", []string{"rating>=3", "path:x"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &TagsView{Tags: tt.tags}
+			q, err := v.Parse()
+			if err != nil {
+				t.Fatalf("Parse() of %q error = %v", v.Expression(), err)
+			}
+			if !q.Match(nil, nil, &DirectoryEntry{Tags: tt.tags}) {
+				t.Errorf("%q does not match its own tags %q", v.Expression(), tt.tags)
+			}
+			if q.Match(nil, nil, &DirectoryEntry{Tags: tt.tags[1:]}) {
+				t.Errorf("%q matches without the tag %q", v.Expression(), tt.tags[0])
+			}
+		})
+	}
+}
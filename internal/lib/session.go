@@ -239,6 +239,40 @@ func (s *Session) AddTagsView(tags []string) error {
 	return nil
 }
 
+// AddTagsQueryView adds a tags view using the given query expression.
+func (s *Session) AddTagsQueryView(query string) error {
+	if _, err := ParseQuery(query); err != nil {
+		return err
+	}
+	s.Views.Tags = append(s.Views.Tags, &TagsView{
+		UUID:  uuid.New(),
+		Query: query,
+	})
+	s.Emit(EventViewTagsAdd, ViewTagsAddEvent{
+		View: s.Views.Tags[len(s.Views.Tags)-1],
+	})
+	s.PendingSave()
+	return nil
+}
+
+// SetTagsViewQuery replaces the query expression of the given tags view.
+func (s *Session) SetTagsViewQuery(u uuid.UUID, query string) error {
+	t, err := s.GetTagsView(u)
+	if err != nil {
+		return err
+	}
+	if _, err := ParseQuery(query); err != nil {
+		return err
+	}
+	t.Query = query
+	t.Tags = nil
+	s.Emit(EventViewTagsUpdate, ViewTagsUpdateEvent{
+		View: t,
+	})
+	s.PendingSave()
+	return nil
+}
+
 func (s *Session) RemoveTagsView(u uuid.UUID) error {
 	for i, t := range s.Views.Tags {
 		if t.UUID.String() == u.String() {
@@ -48,3 +48,15 @@ func GetSettingsDir() (string, error) {
 
 	return s, err
 }
+
+// GetCacheDir returns treesource's directory within the user cache directory.
+func GetCacheDir() (string, error) {
+	s, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	s = filepath.Join(s, "treesource")
+
+	return s, err
+}
@@ -0,0 +1,248 @@
+package lib
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// SpriteSheet describes how an image is divided into frames. If Frames is set, the sheet is those named rectangles. Otherwise it is a grid of cells, read left to right and top to bottom.
+type SpriteSheet struct {
+	CellWidth  int           `json:"CellWidth,omitempty" yaml:"CellWidth,omitempty"`
+	CellHeight int           `json:"CellHeight,omitempty" yaml:"CellHeight,omitempty"`
+	Margin     int           `json:"Margin,omitempty" yaml:"Margin,omitempty"`   // Margin is the space around the edge of the grid.
+	Spacing    int           `json:"Spacing,omitempty" yaml:"Spacing,omitempty"` // Spacing is the space between cells.
+	Columns    int           `json:"Columns,omitempty" yaml:"Columns,omitempty"` // Columns limits the grid's columns. 0 is as many as fit.
+	Rows       int           `json:"Rows,omitempty" yaml:"Rows,omitempty"`       // Rows limits the grid's rows. 0 is as many as fit.
+	Frames     []SpriteFrame `json:"Frames,omitempty" yaml:"Frames,omitempty"`
+}
+
+// SpriteFrame is a named rectangle within a sprite sheet.
+type SpriteFrame struct {
+	Name   string `json:"Name" yaml:"Name"`
+	X      int    `json:"X" yaml:"X"`
+	Y      int    `json:"Y" yaml:"Y"`
+	Width  int    `json:"Width" yaml:"Width"`
+	Height int    `json:"Height" yaml:"Height"`
+}
+
+// Rect returns the frame's rectangle.
+func (f SpriteFrame) Rect() image.Rectangle {
+	return image.Rect(f.X, f.Y, f.X+f.Width, f.Y+f.Height)
+}
+
+// SpriteSheetError is returned when a sprite sheet definition is invalid.
+type SpriteSheetError struct {
+	message string
+}
+
+func (e *SpriteSheetError) Error() string {
+	return fmt.Sprintf("invalid sprite sheet: %s", e.message)
+}
+
+// Clone returns a deep copy of the sheet.
+func (s *SpriteSheet) Clone() *SpriteSheet {
+	if s == nil {
+		return nil
+	}
+	s2 := *s
+	s2.Frames = append([]SpriteFrame(nil), s.Frames...)
+	return &s2
+}
+
+// Validate returns an error if the sheet cannot produce frames.
+func (s *SpriteSheet) Validate() error {
+	if len(s.Frames) > 0 {
+		names := make(map[string]bool)
+		for _, f := range s.Frames {
+			if f.Width <= 0 || f.Height <= 0 {
+				return &SpriteSheetError{fmt.Sprintf("frame '%s' is empty", f.Name)}
+			}
+			if names[f.Name] {
+				return &SpriteSheetError{fmt.Sprintf("frame '%s' is defined more than once", f.Name)}
+			}
+			names[f.Name] = true
+		}
+		return nil
+	}
+	if s.CellWidth <= 0 || s.CellHeight <= 0 {
+		return &SpriteSheetError{"cell size must be positive"}
+	}
+	if s.Margin < 0 || s.Spacing < 0 || s.Columns < 0 || s.Rows < 0 {
+		return &SpriteSheetError{"margin, spacing, columns, and rows cannot be negative"}
+	}
+	return nil
+}
+
+// FrameRects returns the frames of the sheet for an image of the given bounds. Grid frames are named by their zero-padded index. Frames that fall outside of the bounds are clipped or, if nothing remains, left out.
+func (s *SpriteSheet) FrameRects(bounds image.Rectangle) []SpriteFrame {
+	var frames []SpriteFrame
+	add := func(f SpriteFrame) {
+		r := f.Rect().Add(bounds.Min).Intersect(bounds)
+		if r.Empty() {
+			return
+		}
+		r = r.Sub(bounds.Min)
+		f.X, f.Y, f.Width, f.Height = r.Min.X, r.Min.Y, r.Dx(), r.Dy()
+		frames = append(frames, f)
+	}
+
+	if len(s.Frames) > 0 {
+		for _, f := range s.Frames {
+			add(f)
+		}
+		return frames
+	}
+	if s.CellWidth <= 0 || s.CellHeight <= 0 {
+		return nil
+	}
+
+	fit := func(size, cell int) int {
+		n := (size - 2*s.Margin + s.Spacing) / (cell + s.Spacing)
+		if n < 0 {
+			return 0
+		}
+		return n
+	}
+	columns := fit(bounds.Dx(), s.CellWidth)
+	if s.Columns > 0 && s.Columns < columns {
+		columns = s.Columns
+	}
+	rows := fit(bounds.Dy(), s.CellHeight)
+	if s.Rows > 0 && s.Rows < rows {
+		rows = s.Rows
+	}
+	// Pad the names so that they sort in order.
+	digits := len(fmt.Sprint(rows*columns - 1))
+	for y := 0; y < rows; y++ {
+		for x := 0; x < columns; x++ {
+			add(SpriteFrame{
+				Name:   fmt.Sprintf("%0*d", digits, y*columns+x),
+				X:      s.Margin + x*(s.CellWidth+s.Spacing),
+				Y:      s.Margin + y*(s.CellHeight+s.Spacing),
+				Width:  s.CellWidth,
+				Height: s.CellHeight,
+			})
+		}
+	}
+	return frames
+}
+
+// FrameImage is a frame sliced from a sprite sheet.
+type FrameImage struct {
+	SpriteFrame
+	Image *image.RGBA
+}
+
+// SliceFrames slices the image into the sheet's frames.
+func (s *SpriteSheet) SliceFrames(img image.Image) []FrameImage {
+	var frames []FrameImage
+	for _, f := range s.FrameRects(img.Bounds()) {
+		dst := image.NewRGBA(image.Rect(0, 0, f.Width, f.Height))
+		draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min.Add(image.Pt(f.X, f.Y)), draw.Src)
+		frames = append(frames, FrameImage{
+			SpriteFrame: f,
+			Image:       dst,
+		})
+	}
+	return frames
+}
+
+// SetEntrySpriteSheet sets or, if sheet is nil, clears the sprite sheet definition of the given entry as an undoable action.
+func (p *Project) SetEntrySpriteSheet(u uuid.UUID, path string, sheet *SpriteSheet) error {
+	if sheet != nil {
+		if err := sheet.Validate(); err != nil {
+			return err
+		}
+	}
+	_, entry, err := p.entryCopy(u, path)
+	if err != nil {
+		return err
+	}
+	entry.Sheet = sheet.Clone()
+	return p.UpdateDirectoryEntry(u, path, entry)
+}
+
+// entrySheetImage decodes the given entry's image and returns it along with the entry's sprite sheet.
+func (p *Project) entrySheetImage(u uuid.UUID, path string) (image.Image, *SpriteSheet, error) {
+	dir, e, err := p.entryCopy(u, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if e.Sheet == nil {
+		return nil, nil, &SpriteSheetError{fmt.Sprintf("'%s' has no sprite sheet", path)}
+	}
+	f, err := os.Open(filepath.Join(dir, path))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	return img, e.Sheet, nil
+}
+
+// FrameThumbnail is the thumbnail of a sprite sheet frame.
+type FrameThumbnail struct {
+	SpriteFrame
+	Thumbnail Thumbnail `json:"Thumbnail"`
+}
+
+// FrameThumbnails returns a thumbnail of every frame of the given entry's sprite sheet.
+func (p *Project) FrameThumbnails(u uuid.UUID, path string, opts ThumbnailOptions) ([]FrameThumbnail, error) {
+	img, sheet, err := p.entrySheetImage(u, path)
+	if err != nil {
+		return nil, err
+	}
+	thumbnails := make([]FrameThumbnail, 0)
+	for _, f := range sheet.SliceFrames(img) {
+		t, err := encodeThumbnail(ScaleImage(f.Image, opts), "png")
+		if err != nil {
+			return nil, err
+		}
+		thumbnails = append(thumbnails, FrameThumbnail{
+			SpriteFrame: f.SpriteFrame,
+			Thumbnail:   t,
+		})
+	}
+	return thumbnails, nil
+}
+
+// ExportFrames writes every frame of the given entry's sprite sheet to the destination directory as `<name>_<frame>.png`, returning the written paths.
+func (p *Project) ExportFrames(u uuid.UUID, path string, dest string) ([]string, error) {
+	img, sheet, err := p.entrySheetImage(u, path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return nil, err
+	}
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	replacer := strings.NewReplacer("/", "_", "\\", "_", ":", "_")
+
+	written := make([]string, 0)
+	for _, f := range sheet.SliceFrames(img) {
+		name := filepath.Join(dest, base+"_"+replacer.Replace(f.Name)+".png")
+		out, err := os.Create(name)
+		if err != nil {
+			return written, err
+		}
+		err = png.Encode(out, f.Image)
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return written, err
+		}
+		written = append(written, name)
+	}
+	return written, nil
+}
@@ -0,0 +1,365 @@
+package lib
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"treesource/internal/do"
+)
+
+// TagSeparator separates the levels of a hierarchical tag, such as `character/hero/idle`.
+const TagSeparator = "/"
+
+// TagParent returns the parent of a hierarchical tag, or an empty string if it has none.
+func TagParent(tag string) string {
+	if i := strings.LastIndex(tag, TagSeparator); i != -1 {
+		return tag[:i]
+	}
+	return ""
+}
+
+// TagNode is a node within the project's tag hierarchy.
+type TagNode struct {
+	Name     string     `json:"Name"`     // Name is the last part of the tag.
+	Tag      string     `json:"Tag"`      // Tag is the full tag.
+	Count    int        `json:"Count"`    // Count is the number of entries with the tag or any of its children.
+	Children []*TagNode `json:"Children"` // Children are sorted by name.
+}
+
+func (n *TagNode) child(name string) *TagNode {
+	for _, c := range n.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	c := &TagNode{
+		Name:     name,
+		Tag:      strings.TrimPrefix(n.Tag+TagSeparator+name, TagSeparator),
+		Children: make([]*TagNode, 0),
+	}
+	n.Children = append(n.Children, c)
+	return c
+}
+
+func (n *TagNode) sort() {
+	sort.Slice(n.Children, func(i, j int) bool {
+		return n.Children[i].Name < n.Children[j].Name
+	})
+	for _, c := range n.Children {
+		c.sort()
+	}
+}
+
+// TagTree returns the hierarchy of every tag used in the project. The returned root node has no name and counts every tagged entry.
+func (p *Project) TagTree() *TagNode {
+	root := &TagNode{
+		Children: make([]*TagNode, 0),
+	}
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	for i := range p.Directories {
+		for _, e := range p.Directories[i].Entries {
+			// Only count each node once per entry.
+			seen := make(map[*TagNode]struct{})
+			for _, t := range e.Tags {
+				n := root
+				for _, name := range strings.Split(t, TagSeparator) {
+					if name == "" {
+						continue
+					}
+					n = n.child(name)
+					seen[n] = struct{}{}
+				}
+			}
+			for n := range seen {
+				n.Count++
+			}
+			if len(seen) > 0 {
+				root.Count++
+			}
+		}
+	}
+	root.sort()
+	return root
+}
+
+// MissingTagError is returned when a tag is not used by any entry.
+type MissingTagError struct {
+	tag string
+}
+
+func (e *MissingTagError) Error() string {
+	return fmt.Sprintf("tag '%s' is missing", e.tag)
+}
+
+// TagMoveError is returned when a tag cannot be moved to the given parent.
+type TagMoveError struct {
+	tag    string
+	parent string
+}
+
+func (e *TagMoveError) Error() string {
+	return fmt.Sprintf("cannot move tag '%s' beneath '%s'", e.tag, e.parent)
+}
+
+// MoveTag moves the given tag and all of its children beneath a new parent as a single undoable action. An empty parent moves the tag to the top level.
+func (p *Project) MoveTag(tag string, parent string) error {
+	tag = strings.Trim(tag, TagSeparator)
+	parent = strings.Trim(parent, TagSeparator)
+	if tag == "" || parent == tag || strings.HasPrefix(parent, tag+TagSeparator) {
+		return &TagMoveError{tag, parent}
+	}
+	moved := path.Base(tag)
+	if parent != "" {
+		moved = parent + TagSeparator + moved
+	}
+
+	var actions []do.Action[*Project]
+	p.mutex.RLock()
+	r := p.TagRegistry
+	for i := range p.Directories {
+		d := &p.Directories[i]
+		for _, e := range d.Entries {
+			changed := false
+			var tags []string
+			for _, t := range e.Tags {
+				if t == tag || strings.HasPrefix(t, tag+TagSeparator) {
+					t = moved + t[len(tag):]
+					changed = true
+				}
+				if !containsString(tags, t) {
+					tags = append(tags, t)
+				}
+			}
+			if !changed {
+				continue
+			}
+			entry := e.Clone()
+			entry.Tags = r.Apply(tags)
+			actions = append(actions, &UpdateEntryAction{
+				UUID:  d.UUID,
+				path:  e.Path,
+				Entry: entry,
+			})
+		}
+	}
+	p.mutex.RUnlock()
+	if len(actions) == 0 {
+		return &MissingTagError{tag}
+	}
+
+	p.apply(&GroupedAction{
+		Actions: actions,
+	})
+	return nil
+}
+
+func containsString(s []string, v string) bool {
+	for _, s2 := range s {
+		if s2 == v {
+			return true
+		}
+	}
+	return false
+}
+
+// TagRegistry holds the project's tag aliases and implication rules.
+type TagRegistry struct {
+	Aliases map[string]string   `json:"Aliases" yaml:"Aliases,omitempty"` // Aliases maps an alias to its canonical tag.
+	Implies map[string][]string `json:"Implies" yaml:"Implies,omitempty"` // Implies maps a tag to the tags it implies.
+}
+
+// Clone returns a deep copy of the registry.
+func (r *TagRegistry) Clone() TagRegistry {
+	r2 := TagRegistry{}
+	if r.Aliases != nil {
+		r2.Aliases = make(map[string]string)
+		for k, v := range r.Aliases {
+			r2.Aliases[k] = v
+		}
+	}
+	if r.Implies != nil {
+		r2.Implies = make(map[string][]string)
+		for k, v := range r.Implies {
+			r2.Implies[k] = append([]string(nil), v...)
+		}
+	}
+	return r2
+}
+
+// maxAliasRewrites limits how many times an alias may be resolved for a single tag. Aliases that extend themselves, such as "char" to "char/acter", never repeat a tag and so would otherwise resolve forever.
+const maxAliasRewrites = 64
+
+// Canonical resolves any aliases of the tag or of its parents. Should the aliases form a cycle, the tag is returned as far as it was resolved.
+func (r *TagRegistry) Canonical(tag string) string {
+	tag, _ = r.canonical(tag)
+	return tag
+}
+
+// canonical implements Canonical, also returning false if resolving the tag never settled.
+func (r *TagRegistry) canonical(tag string) (string, bool) {
+	seen := make(map[string]struct{})
+	for i := 0; i <= maxAliasRewrites; i++ {
+		if _, ok := seen[tag]; ok {
+			return tag, false
+		}
+		seen[tag] = struct{}{}
+
+		resolved := false
+		for prefix := tag; prefix != ""; prefix = TagParent(prefix) {
+			if to, ok := r.Aliases[prefix]; ok {
+				tag = to + tag[len(prefix):]
+				resolved = true
+				break
+			}
+		}
+		if !resolved {
+			return tag, true
+		}
+	}
+	return tag, false
+}
+
+// Apply canonicalizes the given tags and adds any tags they imply.
+func (r *TagRegistry) Apply(tags []string) []string {
+	if len(r.Aliases) == 0 && len(r.Implies) == 0 {
+		return tags
+	}
+	var result []string
+	var add func(tag string)
+	add = func(tag string) {
+		tag = r.Canonical(tag)
+		if containsString(result, tag) {
+			return
+		}
+		result = append(result, tag)
+		for _, implied := range r.Implies[tag] {
+			add(implied)
+		}
+	}
+	for _, t := range tags {
+		add(t)
+	}
+	return result
+}
+
+// canonicalizeImplications rewrites the implication rules in terms of canonical tags, merging the rules of tags that resolve to the same tag and dropping any implication of a tag by itself, as Apply only looks up rules by canonical tag.
+func (r *TagRegistry) canonicalizeImplications() {
+	if len(r.Implies) == 0 {
+		return
+	}
+	// Merge the rules in order, so that merged rules always imply their tags in the same order.
+	tags := make([]string, 0, len(r.Implies))
+	for tag := range r.Implies {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	implies := make(map[string][]string)
+	for _, tag := range tags {
+		implied := r.Implies[tag]
+		tag = r.Canonical(tag)
+		for _, t := range implied {
+			if t = r.Canonical(t); t != tag && !containsString(implies[tag], t) {
+				implies[tag] = append(implies[tag], t)
+			}
+		}
+	}
+	r.Implies = implies
+}
+
+// TagRuleError is returned when a tag alias or implication is invalid.
+type TagRuleError struct {
+	tag   string
+	other string
+}
+
+func (e *TagRuleError) Error() string {
+	return fmt.Sprintf("invalid rule between '%s' and '%s'", e.tag, e.other)
+}
+
+// SetTagAlias declares alias as an alias of tag. Aliases of a tag beneath themselves, such as "char" to "char/acter", are refused, as are any that would never resolve.
+func (p *Project) SetTagAlias(alias string, tag string) error {
+	if alias == "" || tag == "" || alias == tag || strings.HasPrefix(tag, alias+TagSeparator) {
+		return &TagRuleError{alias, tag}
+	}
+	r := p.tagRegistry()
+	r = r.Clone()
+	if r.Aliases == nil {
+		r.Aliases = make(map[string]string)
+	}
+	r.Aliases[alias] = tag
+	// Refuse aliases that would resolve back to themselves or never settle.
+	if resolved, ok := r.canonical(alias); !ok || resolved == alias {
+		return &TagRuleError{alias, tag}
+	}
+	// Implications of the alias now belong to the tag it resolves to.
+	r.canonicalizeImplications()
+	p.apply(&SetTagRegistryAction{
+		Registry: r,
+	})
+	return nil
+}
+
+// RemoveTagAlias removes the given alias.
+func (p *Project) RemoveTagAlias(alias string) error {
+	r := p.tagRegistry()
+	if _, ok := r.Aliases[alias]; !ok {
+		return &MissingTagError{alias}
+	}
+	r = r.Clone()
+	delete(r.Aliases, alias)
+	p.apply(&SetTagRegistryAction{
+		Registry: r,
+	})
+	return nil
+}
+
+// AddTagImplication declares that tag implies implied. Both are stored as their canonical tags, so an implication declared on an alias applies to the tag it resolves to.
+func (p *Project) AddTagImplication(tag string, implied string) error {
+	if tag == "" || implied == "" {
+		return &TagRuleError{tag, implied}
+	}
+	r := p.tagRegistry()
+	if tag, implied = r.Canonical(tag), r.Canonical(implied); tag == implied {
+		return &TagRuleError{tag, implied}
+	}
+	if containsString(r.Implies[tag], implied) {
+		return nil
+	}
+	r = r.Clone()
+	if r.Implies == nil {
+		r.Implies = make(map[string][]string)
+	}
+	r.Implies[tag] = append(r.Implies[tag], implied)
+	p.apply(&SetTagRegistryAction{
+		Registry: r,
+	})
+	return nil
+}
+
+// RemoveTagImplication removes the implication of implied by tag. Either may be given as an alias.
+func (p *Project) RemoveTagImplication(tag string, implied string) error {
+	r := p.tagRegistry()
+	tag, implied = r.Canonical(tag), r.Canonical(implied)
+	if !containsString(r.Implies[tag], implied) {
+		return &MissingTagError{implied}
+	}
+	r = r.Clone()
+	var tags []string
+	for _, t := range r.Implies[tag] {
+		if t != implied {
+			tags = append(tags, t)
+		}
+	}
+	if len(tags) == 0 {
+		delete(r.Implies, tag)
+	} else {
+		r.Implies[tag] = tags
+	}
+	p.apply(&SetTagRegistryAction{
+		Registry: r,
+	})
+	return nil
+}
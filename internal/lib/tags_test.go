@@ -0,0 +1,191 @@
+package lib
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTagRegistryCanonical(t *testing.T) {
+	tests := []struct {
+		name    string
+		aliases map[string]string
+		tag     string
+		want    string
+	}{
+		{"no aliases", nil, "cat", "cat"},
+		{"alias", map[string]string{"kitty": "cat"}, "kitty", "cat"},
+		{"unaliased", map[string]string{"kitty": "cat"}, "dog", "dog"},
+		{"chain", map[string]string{"kitten": "kitty", "kitty": "cat"}, "kitten", "cat"},
+		{"parent", map[string]string{"char": "character"}, "char/hero", "character/hero"},
+		{"deepest parent first", map[string]string{"a": "x", "a/b": "y"}, "a/b/c", "y/c"},
+		{"not a parent", map[string]string{"char": "character"}, "charm", "charm"},
+		{"cycle", map[string]string{"a": "b", "b": "a"}, "a", "a"},
+		{"extends itself", map[string]string{"char": "char/acter"}, "char", "char" + strings.Repeat("/acter", maxAliasRewrites+1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := TagRegistry{Aliases: tt.aliases}
+			if got := r.Canonical(tt.tag); got != tt.want {
+				t.Errorf("Canonical(%q) = %q, want %q", tt.tag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTagRegistryCanonicalSettles(t *testing.T) {
+	tests := []struct {
+		name    string
+		aliases map[string]string
+		tag     string
+		want    bool
+	}{
+		{"settles", map[string]string{"kitty": "cat"}, "kitty", true},
+		{"cycle", map[string]string{"a": "b", "b": "a"}, "a", false},
+		{"extends itself", map[string]string{"char": "char/acter"}, "char/hero", false},
+		{"extends itself through another", map[string]string{"a": "b/a", "b": "a"}, "a", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := TagRegistry{Aliases: tt.aliases}
+			if _, got := r.canonical(tt.tag); got != tt.want {
+				t.Errorf("canonical(%q) settled = %v, want %v", tt.tag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTagRegistryApply(t *testing.T) {
+	r := TagRegistry{
+		Aliases: map[string]string{
+			"kitty": "cat",
+			"char":  "character",
+		},
+		Implies: map[string][]string{
+			"cat":            {"animal"},
+			"animal":         {"living"},
+			"character/hero": {"character"},
+			"loop":           {"loop"},
+		},
+	}
+	tests := []struct {
+		name string
+		tags []string
+		want []string
+	}{
+		{"empty", nil, nil},
+		{"untouched", []string{"dog"}, []string{"dog"}},
+		{"alias and implications", []string{"kitty"}, []string{"cat", "animal", "living"}},
+		{"duplicates merged", []string{"kitty", "cat", "animal"}, []string{"cat", "animal", "living"}},
+		{"aliased parent implies", []string{"char/hero"}, []string{"character/hero", "character"}},
+		{"implies itself", []string{"loop"}, []string{"loop"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.Apply(tt.tags); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Apply(%q) = %q, want %q", tt.tags, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetTagAlias(t *testing.T) {
+	tests := []struct {
+		name    string
+		aliases map[string]string
+		alias   string
+		tag     string
+		wantErr bool
+	}{
+		{"alias", nil, "kitty", "cat", false},
+		{"empty alias", nil, "", "cat", true},
+		{"empty tag", nil, "kitty", "", true},
+		{"itself", nil, "cat", "cat", true},
+		{"cycle", map[string]string{"cat": "kitty"}, "kitty", "cat", true},
+		{"beneath itself", nil, "char", "char/acter", true},
+		{"sibling with shared prefix", nil, "char", "charm", false},
+		{"never settles", map[string]string{"b": "a"}, "a", "b/a", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProject()
+			p.TagRegistry.Aliases = tt.aliases
+			err := p.SetTagAlias(tt.alias, tt.tag)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetTagAlias(%q, %q) error = %v, wantErr %v", tt.alias, tt.tag, err, tt.wantErr)
+			}
+			if err == nil && p.TagRegistry.Canonical(tt.alias) != tt.tag {
+				t.Errorf("Canonical(%q) = %q after alias, want %q", tt.alias, p.TagRegistry.Canonical(tt.alias), tt.tag)
+			}
+		})
+	}
+}
+
+func TestAddTagImplication(t *testing.T) {
+	tests := []struct {
+		name    string
+		aliases map[string]string
+		tag     string
+		implied string
+		want    []string // want is the result of applying the registry to tag.
+		wantErr bool
+	}{
+		{"implication", nil, "cat", "animal", []string{"cat", "animal"}, false},
+		{"on an alias", map[string]string{"kitty": "cat"}, "kitty", "animal", []string{"cat", "animal"}, false},
+		{"of an alias", map[string]string{"beast": "animal"}, "cat", "beast", []string{"cat", "animal"}, false},
+		{"itself", nil, "cat", "cat", nil, true},
+		{"itself through an alias", map[string]string{"kitty": "cat"}, "kitty", "cat", nil, true},
+		{"empty", nil, "cat", "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProject()
+			p.TagRegistry.Aliases = tt.aliases
+			err := p.AddTagImplication(tt.tag, tt.implied)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AddTagImplication(%q, %q) error = %v, wantErr %v", tt.tag, tt.implied, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := p.TagRegistry.Apply([]string{tt.tag}); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Apply(%q) = %q, want %q", tt.tag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetTagAliasMovesImplications(t *testing.T) {
+	p := NewProject()
+	if err := p.AddTagImplication("kitty", "animal"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AddTagImplication("cat", "pet"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetTagAlias("kitty", "cat"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"cat", "pet", "animal"}
+	if got := p.TagRegistry.Apply([]string{"kitty"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply(kitty) = %q, want %q", got, want)
+	}
+}
+
+func TestMoveTagAppliesRegistry(t *testing.T) {
+	p := NewProject()
+	p.TagRegistry = TagRegistry{
+		Aliases: map[string]string{"char": "character"},
+		Implies: map[string][]string{"character/hero": {"playable"}},
+	}
+	p.Directories = []Directory{{
+		Entries: []*DirectoryEntry{{Path: "hero.png", Tags: []string{"hero"}}},
+	}}
+	if err := p.MoveTag("hero", "char"); err != nil {
+		t.Fatalf("MoveTag() error = %v", err)
+	}
+	want := []string{"character/hero", "playable"}
+	if got := p.Directories[0].Entries[0].Tags; !reflect.DeepEqual(got, want) {
+		t.Errorf("tags after MoveTag() = %q, want %q", got, want)
+	}
+}
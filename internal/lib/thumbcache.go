@@ -0,0 +1,211 @@
+package lib
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultThumbnailCacheLimit is the default size limit, in bytes, of the thumbnail cache.
+var DefaultThumbnailCacheLimit int64 = 256 * 1024 * 1024
+
+// ThumbnailCache is an on-disk cache of generated thumbnails, keyed by the source file's absolute path, size, modification time, and the thumbnail options. The least recently used thumbnails are evicted once the cache grows beyond its limit.
+//
+// Each thumbnail is stored as `<path hash>-<key hash>.<format>`, so that every thumbnail of a file can be found by its path alone and the format survives restarts.
+type ThumbnailCache struct {
+	dir     string
+	limit   int64
+	size    int64
+	loaded  bool
+	mutex   sync.Mutex
+	items   map[string]*list.Element // items are keyed by file name without the format extension.
+	recency *list.List               // recency holds *thumbnailCacheItem, most recently used first.
+}
+
+type thumbnailCacheItem struct {
+	key    string
+	format string
+	size   int64
+}
+
+func (i *thumbnailCacheItem) name() string {
+	return i.key + "." + i.format
+}
+
+// NewThumbnailCache returns a thumbnail cache stored in the given directory. The directory is not read until the cache is first used.
+func NewThumbnailCache(dir string, limit int64) *ThumbnailCache {
+	return &ThumbnailCache{
+		dir:     dir,
+		limit:   limit,
+		items:   make(map[string]*list.Element),
+		recency: list.New(),
+	}
+}
+
+// GetThumbnailCacheDir returns the thumbnail cache's directory within the user cache directory.
+func GetThumbnailCacheDir() (string, error) {
+	s, err := GetCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s, "thumbnails"), nil
+}
+
+// load reads the existing cache from disk, ordering it by modification time, which is touched on every use.
+func (c *ThumbnailCache) load() {
+	if c.loaded {
+		return
+	}
+	c.loaded = true
+
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+	var infos []fs.FileInfo
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			infos = append(infos, info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().After(infos[j].ModTime())
+	})
+	for _, info := range infos {
+		ext := filepath.Ext(info.Name())
+		if ext == "" {
+			continue
+		}
+		key := strings.TrimSuffix(info.Name(), ext)
+		c.items[key] = c.recency.PushBack(&thumbnailCacheItem{
+			key:    key,
+			format: ext[1:],
+			size:   info.Size(),
+		})
+		c.size += info.Size()
+	}
+	c.evict()
+}
+
+// evict removes the least recently used thumbnails until the cache is within its limit.
+func (c *ThumbnailCache) evict() {
+	for c.size > c.limit && c.recency.Len() > 0 {
+		c.remove(c.recency.Back())
+	}
+}
+
+func (c *ThumbnailCache) remove(el *list.Element) {
+	item := el.Value.(*thumbnailCacheItem)
+	c.recency.Remove(el)
+	delete(c.items, item.key)
+	c.size -= item.size
+	os.Remove(filepath.Join(c.dir, item.name()))
+}
+
+func thumbnailPathHash(path string) string {
+	h := sha256.Sum256([]byte(path))
+	return hex.EncodeToString(h[:8])
+}
+
+func thumbnailKeyHash(path string, info fs.FileInfo, opts ThumbnailOptions) string {
+	key := fmt.Sprintf("%s\x00%d\x00%d\x00%d\x00%d\x00%s", path, info.Size(), info.ModTime().UnixNano(), opts.MaxWidth, opts.MaxHeight, opts.Method)
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:8])
+}
+
+// Get returns the cached thumbnail of the file at the given absolute path, if it is cached for the file's current size and modification time.
+func (c *ThumbnailCache) Get(path string, info fs.FileInfo, opts ThumbnailOptions) (Thumbnail, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.load()
+
+	el, ok := c.items[thumbnailPathHash(path)+"-"+thumbnailKeyHash(path, info, opts)]
+	if !ok {
+		return Thumbnail{}, false
+	}
+	item := el.Value.(*thumbnailCacheItem)
+	name := filepath.Join(c.dir, item.name())
+	b, err := os.ReadFile(name)
+	if err != nil {
+		c.remove(el)
+		return Thumbnail{}, false
+	}
+	c.recency.MoveToFront(el)
+	now := time.Now()
+	os.Chtimes(name, now, now)
+
+	return Thumbnail{
+		Bytes:  b,
+		Format: item.format,
+	}, true
+}
+
+// Put caches the thumbnail of the file at the given absolute path.
+func (c *ThumbnailCache) Put(path string, info fs.FileInfo, opts ThumbnailOptions, t Thumbnail) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.load()
+
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+	key := thumbnailPathHash(path) + "-" + thumbnailKeyHash(path, info, opts)
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	item := &thumbnailCacheItem{
+		key:    key,
+		format: t.Format,
+		size:   int64(len(t.Bytes)),
+	}
+	if err := os.WriteFile(filepath.Join(c.dir, item.name()), t.Bytes, 0644); err != nil {
+		return err
+	}
+	c.items[key] = c.recency.PushFront(item)
+	c.size += int64(len(t.Bytes))
+	c.evict()
+	return nil
+}
+
+// Invalidate removes every cached thumbnail of the file at the given absolute path.
+func (c *ThumbnailCache) Invalidate(path string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.load()
+
+	prefix := thumbnailPathHash(path) + "-"
+	for key, el := range c.items {
+		if strings.HasPrefix(key, prefix) {
+			c.remove(el)
+		}
+	}
+}
+
+// SetLimit sets the size limit of the cache in bytes, evicting thumbnails if it is now over the limit.
+func (c *ThumbnailCache) SetLimit(limit int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.limit = limit
+	if c.loaded {
+		c.evict()
+	}
+}
+
+// Size returns the current size of the cache in bytes.
+func (c *ThumbnailCache) Size() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.load()
+	return c.size
+}
@@ -0,0 +1,230 @@
+package lib
+
+import (
+	"container/heap"
+	"runtime"
+	"sync"
+)
+
+// ThumbnailWorkers is the number of thumbnails a Thumbnailer generates at once.
+var ThumbnailWorkers = runtime.NumCPU()
+
+// ThumbnailRequest is a request for a thumbnail to be generated in the background.
+type ThumbnailRequest struct {
+	ID       string           `json:"ID"` // ID identifies the request in events, priority changes, and cancellations. Defaults to Path.
+	Path     string           `json:"Path"`
+	Options  ThumbnailOptions `json:"Options"`
+	Priority int              `json:"Priority"` // Higher priorities are generated first.
+}
+
+// Thumbnailer generates thumbnails on a bounded pool of goroutines, highest priority first. Each finished thumbnail is emitted as a thumbnail event. Emits: thumbnail
+type Thumbnailer struct {
+	Emitter
+	cache   *ThumbnailCache
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	queue   thumbnailQueue
+	jobs    map[string]*thumbnailJob // jobs are both the queued and running jobs.
+	seq     int
+	started bool
+}
+
+type thumbnailJob struct {
+	ThumbnailRequest
+	seq      int
+	index    int // index is the job's position in the queue, or -1 if it is running.
+	canceled bool
+	next     *ThumbnailRequest // next is a request for the running job with a different path or options, queued once the job finishes.
+}
+
+// NewThumbnailer returns a Thumbnailer that uses the given cache, which may be nil. Its workers are started on the first request.
+func NewThumbnailer(cache *ThumbnailCache) *Thumbnailer {
+	t := &Thumbnailer{
+		Emitter: *NewEmitter(),
+		cache:   cache,
+		jobs:    make(map[string]*thumbnailJob),
+	}
+	t.cond = sync.NewCond(&t.mutex)
+	return t
+}
+
+// Request queues the given requests. A request with the ID of one that is still queued replaces it. A request with the ID of one that is being generated is queued once it finishes if its path or options differ, and the outdated thumbnail is not emitted.
+func (t *Thumbnailer) Request(reqs []ThumbnailRequest) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !t.started {
+		t.started = true
+		for i := 0; i < ThumbnailWorkers; i++ {
+			go t.work()
+		}
+	}
+
+	for _, r := range reqs {
+		if r.ID == "" {
+			r.ID = r.Path
+		}
+		if j, ok := t.jobs[r.ID]; ok {
+			if j.index == -1 {
+				// Already running, so let it finish rather than generating it twice.
+				j.canceled = false
+				j.next = nil
+				if r.Path != j.Path || r.Options != j.Options {
+					next := r
+					j.next = &next
+				}
+				continue
+			}
+			j.ThumbnailRequest = r
+			heap.Fix(&t.queue, j.index)
+			continue
+		}
+		t.push(r)
+	}
+	t.cond.Broadcast()
+}
+
+// push queues a new job for the given request. The mutex must be held.
+func (t *Thumbnailer) push(r ThumbnailRequest) {
+	t.seq++
+	j := &thumbnailJob{
+		ThumbnailRequest: r,
+		seq:              t.seq,
+	}
+	t.jobs[r.ID] = j
+	heap.Push(&t.queue, j)
+}
+
+// Prioritize sets the priority of the given queued requests, including those waiting on a running request of the same ID.
+func (t *Thumbnailer) Prioritize(ids []string, priority int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, id := range ids {
+		j, ok := t.jobs[id]
+		if !ok {
+			continue
+		}
+		if j.index == -1 {
+			if j.next != nil {
+				j.next.Priority = priority
+			}
+			continue
+		}
+		j.Priority = priority
+		heap.Fix(&t.queue, j.index)
+	}
+}
+
+// Cancel removes the given requests from the queue. Requests that are already being generated will not emit their thumbnail.
+func (t *Thumbnailer) Cancel(ids []string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, id := range ids {
+		j, ok := t.jobs[id]
+		if !ok {
+			continue
+		}
+		if j.index == -1 {
+			j.canceled = true
+			j.next = nil
+			continue
+		}
+		heap.Remove(&t.queue, j.index)
+		delete(t.jobs, id)
+	}
+}
+
+// CancelAll removes every request from the queue.
+func (t *Thumbnailer) CancelAll() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for id, j := range t.jobs {
+		if j.index == -1 {
+			j.canceled = true
+			j.next = nil
+			continue
+		}
+		delete(t.jobs, id)
+	}
+	t.queue = nil
+}
+
+// Pending returns the number of requests that are queued or being generated.
+func (t *Thumbnailer) Pending() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return len(t.jobs)
+}
+
+func (t *Thumbnailer) work() {
+	for {
+		t.mutex.Lock()
+		for t.queue.Len() == 0 {
+			t.cond.Wait()
+		}
+		j := heap.Pop(&t.queue).(*thumbnailJob)
+		t.mutex.Unlock()
+
+		thumbnail, err := generateThumbnail(t.cache, j.Path, j.Options)
+
+		t.mutex.Lock()
+		delete(t.jobs, j.ID)
+		canceled := j.canceled || j.next != nil
+		if j.next != nil {
+			t.push(*j.next)
+			t.cond.Signal()
+		}
+		t.mutex.Unlock()
+		if canceled {
+			continue
+		}
+
+		evt := ThumbnailEvent{
+			ID:        j.ID,
+			Path:      j.Path,
+			Thumbnail: thumbnail,
+		}
+		if err != nil {
+			evt.Error = err.Error()
+		}
+		t.Emit(EventThumbnail, evt)
+	}
+}
+
+// thumbnailQueue is a heap of jobs ordered by priority, then by the order they were requested in.
+type thumbnailQueue []*thumbnailJob
+
+func (q thumbnailQueue) Len() int {
+	return len(q)
+}
+
+func (q thumbnailQueue) Less(i, j int) bool {
+	if q[i].Priority == q[j].Priority {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].Priority > q[j].Priority
+}
+
+func (q thumbnailQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *thumbnailQueue) Push(x interface{}) {
+	j := x.(*thumbnailJob)
+	j.index = len(*q)
+	*q = append(*q, j)
+}
+
+func (q *thumbnailQueue) Pop() interface{} {
+	old := *q
+	j := old[len(old)-1]
+	old[len(old)-1] = nil
+	j.index = -1
+	*q = old[:len(old)-1]
+	return j
+}
@@ -1,6 +1,10 @@
 package lib
 
-import "github.com/google/uuid"
+import (
+	"strings"
+
+	"github.com/google/uuid"
+)
 
 type DirectoryView struct {
 	UUID      uuid.UUID `json:"uuid" yaml:"uuid"`
@@ -12,7 +16,42 @@ type DirectoryView struct {
 
 type TagsView struct {
 	UUID     uuid.UUID `json:"uuid" yaml:"uuid"`
-	Tags     []string  `json:"tags" yaml:"tags"`
+	Tags     []string  `json:"tags" yaml:"tags,omitempty"` // Tags is the older flat list of required tags, used if Query is empty.
+	Query    string    `json:"query" yaml:"query,omitempty"`
 	Selected []string  `json:"selected" yaml:"selected"`
 	Focused  string    `json:"focused" yaml:"focused"`
+	query    *Query
+}
+
+// Expression returns the view's query expression.
+func (t *TagsView) Expression() string {
+	if t.Query == "" {
+		var tags []string
+		for _, tag := range t.Tags {
+			tags = append(tags, quoteQueryTag(tag))
+		}
+		return strings.Join(tags, " ")
+	}
+	return t.Query
+}
+
+// Parse returns the view's parsed query.
+func (t *TagsView) Parse() (*Query, error) {
+	if t.query == nil || t.query.Source != t.Expression() {
+		q, err := ParseQuery(t.Expression())
+		if err != nil {
+			return nil, err
+		}
+		t.query = q
+	}
+	return t.query, nil
+}
+
+// Matches returns if the given entry within the given directory matches the view's query.
+func (t *TagsView) Matches(registry *TagRegistry, d *Directory, e *DirectoryEntry) bool {
+	q, err := t.Parse()
+	if err != nil {
+		return false
+	}
+	return q.Match(registry, d, e)
 }
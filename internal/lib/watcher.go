@@ -0,0 +1,258 @@
+package lib
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/google/uuid"
+)
+
+// WatchDebounce is how long a directory watcher waits for filesystem changes to settle before applying them.
+var WatchDebounce = 250 * time.Millisecond
+
+// WatchMaxDelay is the longest a directory watcher will hold onto changes while they continue to arrive.
+var WatchMaxDelay = 2 * time.Second
+
+// directoryWatcher watches a directory tree and incrementally syncs the changed paths.
+type directoryWatcher struct {
+	uuid      uuid.UUID
+	root      string
+	ignoreDot bool
+	// followLinks is if symlinked directories are watched as well.
+	followLinks bool
+	patterns    []string
+	ignores     *ignoreCache // ignores is only used by the watcher's goroutine once it is running.
+	watcher     *fsnotify.Watcher
+	done        chan struct{}
+}
+
+// ignored returns if the given path relative to the watched root should be ignored.
+func (w *directoryWatcher) ignored(local string, isDir bool) bool {
+	if w.ignoreDot {
+		for _, part := range strings.Split(local, string(os.PathSeparator)) {
+			if part != "" && part[0] == '.' {
+				return true
+			}
+		}
+	}
+	return w.ignores.Ignored(local, isDir)
+}
+
+// addTree adds a watch to the given directory and all of its subdirectories, including symlinked ones if following links.
+func (w *directoryWatcher) addTree(name string) error {
+	local, err := filepath.Rel(w.root, name)
+	if err != nil {
+		return err
+	}
+	if local == "." {
+		local = ""
+	}
+	return w.addDir(newScanItem(w.root, local, w.followLinks))
+}
+
+func (w *directoryWatcher) addDir(item scanItem) error {
+	name := filepath.Join(w.root, item.local)
+	if err := w.watcher.Add(name); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(name)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.IsDir() && (e.Type()&fs.ModeSymlink == 0 || !w.followLinks) {
+			continue
+		}
+		local := filepath.Join(item.local, e.Name())
+		info, err := os.Stat(filepath.Join(w.root, local))
+		if err != nil || !info.IsDir() || w.ignored(local, true) {
+			continue
+		}
+		subdir := scanItem{
+			local: local,
+		}
+		// Stop at symlinks that loop back up.
+		if w.followLinks {
+			if id, ok := getFileID(filepath.Join(w.root, local), info); ok {
+				if containsFileID(item.ids, id) {
+					continue
+				}
+				subdir.ids = append(append([]fileID(nil), item.ids...), id)
+			}
+		}
+		if err := w.addDir(subdir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Watching returns if the given directory is being watched.
+func (p *Project) Watching(u uuid.UUID) bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	_, ok := p.watchers[u]
+	return ok
+}
+
+// StartWatching begins watching the given directory for changes. Changes emit the same add, missing, and found events as SyncEntries. The project's write lock must be held, as it is for actions.
+func (p *Project) StartWatching(d *Directory) error {
+	if p.watchers == nil {
+		p.watchers = make(map[uuid.UUID]*directoryWatcher)
+	}
+	if _, ok := p.watchers[d.UUID]; ok {
+		return nil
+	}
+
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	w := &directoryWatcher{
+		uuid:        d.UUID,
+		root:        d.Path,
+		ignoreDot:   d.IgnoreDot,
+		followLinks: d.FollowLinks,
+		patterns:    d.Ignore,
+		ignores:     newIgnoreCache(d.Path, d.Ignore),
+		watcher:     fw,
+		done:        make(chan struct{}),
+	}
+	if err := w.addTree(d.Path); err != nil {
+		fw.Close()
+		return err
+	}
+	p.watchers[d.UUID] = w
+
+	go p.runWatcher(w)
+
+	p.Emit(EventDirectoryWatch, DirectoryWatchEvent{
+		UUID:     d.UUID,
+		Watching: true,
+	})
+	return nil
+}
+
+// StopWatching stops watching the given directory. The project's write lock must be held, as it is for actions.
+func (p *Project) StopWatching(u uuid.UUID) {
+	w, ok := p.watchers[u]
+	if !ok {
+		return
+	}
+	delete(p.watchers, u)
+	close(w.done)
+	w.watcher.Close()
+
+	p.Emit(EventDirectoryWatch, DirectoryWatchEvent{
+		UUID:     u,
+		Watching: false,
+	})
+}
+
+// rewatch restarts the given directory's watcher, if it has one, so that it uses the directory's current settings.
+func (p *Project) rewatch(d *Directory) {
+	if _, ok := p.watchers[d.UUID]; !ok {
+		return
+	}
+	p.StopWatching(d.UUID)
+	p.StartWatching(d)
+}
+
+// StopWatchers stops all directory watchers.
+func (p *Project) StopWatchers() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for u := range p.watchers {
+		p.StopWatching(u)
+	}
+}
+
+func (p *Project) runWatcher(w *directoryWatcher) {
+	pending := make(map[string]struct{})
+	var timer *time.Timer
+	var flush <-chan time.Time
+	var first time.Time
+
+	for {
+		select {
+		case <-w.done:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			local, err := filepath.Rel(w.root, event.Name)
+			if err != nil || local == "." {
+				continue
+			}
+			// Changed ignore files change what is ignored beneath them.
+			if filepath.Base(local) == IgnoreFile {
+				w.ignores = newIgnoreCache(w.root, w.patterns)
+			}
+			info, err := os.Stat(event.Name)
+			isDir := err == nil && info.IsDir()
+			if w.ignored(local, isDir) {
+				continue
+			}
+			// New directories need watches of their own.
+			if event.Op&fsnotify.Create != 0 && isDir {
+				w.addTree(event.Name)
+			}
+			if len(pending) == 0 {
+				first = time.Now()
+			}
+			pending[local] = struct{}{}
+
+			// Debounce bursts of changes, but do not hold onto them forever.
+			delay := WatchDebounce
+			if remaining := WatchMaxDelay - time.Since(first); remaining < delay {
+				delay = remaining
+			}
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.NewTimer(delay)
+			flush = timer.C
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			p.Emit(EventDirectoryWatch, DirectoryWatchEvent{
+				UUID:     w.uuid,
+				Watching: true,
+				Error:    err,
+			})
+		case <-flush:
+			flush = nil
+			timer = nil
+			var paths []string
+			for local := range pending {
+				paths = append(paths, local)
+			}
+			pending = make(map[string]struct{})
+
+			// The paths are read and hashed without the lock, then applied to the directory if it still exists.
+			p.mutex.RLock()
+			d, err := p.GetDirectoryByUUID(w.uuid)
+			if err != nil {
+				p.mutex.RUnlock()
+				continue
+			}
+			settings, known := d.settings(), d.knownEntries()
+			p.mutex.RUnlock()
+			scan := settings.scanPaths(paths, known)
+			p.mutex.Lock()
+			if d, err := p.GetDirectoryByUUID(w.uuid); err == nil {
+				d.applyPaths(scan)
+			}
+			p.mutex.Unlock()
+		}
+	}
+}
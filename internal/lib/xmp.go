@@ -0,0 +1,577 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"treesource/internal/do"
+)
+
+// XMP sidecar modes.
+const (
+	XMPRead  = "read"  // XMPRead updates entries from their sidecars.
+	XMPWrite = "write" // XMPWrite updates sidecars from their entries.
+	XMPBoth  = "both"  // XMPBoth updates whichever side has changed.
+)
+
+const (
+	xmpNamespaceRDF = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	xmpNamespaceDC  = "http://purl.org/dc/elements/1.1/"
+	xmpNamespaceXMP = "http://ns.adobe.com/xap/1.0/"
+)
+
+// XMPState is the tags and rating held by an entry or its XMP sidecar.
+type XMPState struct {
+	Tags   []string `json:"Tags" yaml:"Tags,omitempty"`
+	Rating float64  `json:"Rating" yaml:"Rating,omitempty"`
+}
+
+// Clone returns a deep copy of the state.
+func (s *XMPState) Clone() *XMPState {
+	if s == nil {
+		return nil
+	}
+	return &XMPState{
+		Tags:   append([]string(nil), s.Tags...),
+		Rating: s.Rating,
+	}
+}
+
+// Equal returns if both states hold the same rating and the same tags, in any order.
+func (s XMPState) Equal(o XMPState) bool {
+	if s.Rating != o.Rating || len(s.Tags) != len(o.Tags) {
+		return false
+	}
+	a := append([]string(nil), s.Tags...)
+	b := append([]string(nil), o.Tags...)
+	sort.Strings(a)
+	sort.Strings(b)
+	return equalStrings(a, b)
+}
+
+// XMPConflict is an entry whose tags or rating changed both in the project and in its sidecar since they were last synced.
+type XMPConflict struct {
+	Directory   uuid.UUID `json:"Directory"`
+	Path        string    `json:"Path"`
+	SidecarPath string    `json:"SidecarPath"`
+	Project     XMPState  `json:"Project"`
+	Sidecar     XMPState  `json:"Sidecar"`
+}
+
+// XMPFailure is an entry whose sidecar could not be read or written.
+type XMPFailure struct {
+	Path  string `json:"Path"`
+	Error string `json:"Error"`
+}
+
+// XMPSyncReport describes the result of syncing a directory with its sidecars.
+type XMPSyncReport struct {
+	Read      int           `json:"Read"`    // Read is the number of entries updated from their sidecars.
+	Written   int           `json:"Written"` // Written is the number of sidecars updated from their entries.
+	Conflicts []XMPConflict `json:"Conflicts"`
+	Failures  []XMPFailure  `json:"Failures"`
+}
+
+// XMPModeError is returned when an unknown sidecar mode is requested, or when sidecars are not enabled for a directory.
+type XMPModeError struct {
+	dir  string
+	mode string
+}
+
+func (e *XMPModeError) Error() string {
+	if e.mode == "" {
+		return fmt.Sprintf("XMP sidecars are not enabled for '%s'", e.dir)
+	}
+	return fmt.Sprintf("unknown XMP sidecar mode '%s'", e.mode)
+}
+
+// XMPSidecarError is returned when a sidecar cannot be understood.
+type XMPSidecarError struct {
+	path    string
+	message string
+}
+
+func (e *XMPSidecarError) Error() string {
+	return fmt.Sprintf("invalid XMP sidecar '%s': %s", e.path, e.message)
+}
+
+// XMPSidecarPath returns the sidecar of the given file and if it exists. Both darktable's `photo.jpg.xmp` and Lightroom's `photo.xmp` are recognized, with the former used for new sidecars.
+func XMPSidecarPath(path string) (string, bool) {
+	full := path + ".xmp"
+	if _, err := os.Stat(full); err == nil {
+		return full, true
+	}
+	short := strings.TrimSuffix(path, filepath.Ext(path)) + ".xmp"
+	if _, err := os.Stat(short); err == nil {
+		return short, true
+	}
+	return full, false
+}
+
+// ReadXMPSidecar reads the dc:subject tags and xmp:Rating of the given sidecar.
+func ReadXMPSidecar(path string) (XMPState, error) {
+	var s XMPState
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+	d := xml.NewDecoder(bytes.NewReader(b))
+	var inSubject, inItem, inRating bool
+	var text strings.Builder
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				return s, nil
+			}
+			return s, &XMPSidecarError{path, err.Error()}
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch {
+			case t.Name.Space == xmpNamespaceRDF && t.Name.Local == "Description":
+				for _, a := range t.Attr {
+					if a.Name.Space == xmpNamespaceXMP && a.Name.Local == "Rating" {
+						if s.Rating, err = strconv.ParseFloat(strings.TrimSpace(a.Value), 64); err != nil {
+							return s, &XMPSidecarError{path, fmt.Sprintf("invalid rating '%s'", a.Value)}
+						}
+					}
+				}
+			case t.Name.Space == xmpNamespaceDC && t.Name.Local == "subject":
+				inSubject = true
+			case inSubject && t.Name.Space == xmpNamespaceRDF && t.Name.Local == "li":
+				inItem = true
+				text.Reset()
+			case t.Name.Space == xmpNamespaceXMP && t.Name.Local == "Rating":
+				inRating = true
+				text.Reset()
+			}
+		case xml.EndElement:
+			switch {
+			case t.Name.Space == xmpNamespaceDC && t.Name.Local == "subject":
+				inSubject = false
+			case inItem && t.Name.Space == xmpNamespaceRDF && t.Name.Local == "li":
+				inItem = false
+				if tag := strings.TrimSpace(text.String()); tag != "" && !containsString(s.Tags, tag) {
+					s.Tags = append(s.Tags, tag)
+				}
+			case inRating && t.Name.Space == xmpNamespaceXMP && t.Name.Local == "Rating":
+				inRating = false
+				if s.Rating, err = strconv.ParseFloat(strings.TrimSpace(text.String()), 64); err != nil {
+					return s, &XMPSidecarError{path, fmt.Sprintf("invalid rating '%s'", text.String())}
+				}
+			}
+		case xml.CharData:
+			if inItem || inRating {
+				text.Write(t)
+			}
+		}
+	}
+}
+
+// xmpRatingAttribute matches a prefixed Rating attribute, whose prefix is checked against the namespaces in scope.
+var xmpRatingAttribute = regexp.MustCompile(`\s+([^\s=:]+):Rating\s*=\s*("[^"]*"|'[^']*')`)
+
+// xmpEdit replaces a byte range of a sidecar.
+type xmpEdit struct {
+	start, end int
+	text       string
+}
+
+// xmpDescriptionTag is an rdf:Description start tag within a sidecar along with the namespace prefixes in scope at it.
+type xmpDescriptionTag struct {
+	start, end int
+	bindings   map[string]string
+}
+
+// prefix returns a prefix bound to the given namespace, or false if there is none.
+func (t xmpDescriptionTag) prefix(space string) (string, bool) {
+	var prefixes []string
+	for p, s := range t.bindings {
+		if s == space && p != "" {
+			prefixes = append(prefixes, p)
+		}
+	}
+	if len(prefixes) == 0 {
+		return "", false
+	}
+	sort.Strings(prefixes)
+	return prefixes[0], true
+}
+
+// unusedPrefix returns the given prefix, numbered if needed so that it does not shadow any prefix in scope.
+func (t xmpDescriptionTag) unusedPrefix(prefix string) string {
+	name := prefix
+	for i := 1; ; i++ {
+		if _, ok := t.bindings[name]; !ok {
+			return name
+		}
+		name = prefix + strconv.Itoa(i)
+	}
+}
+
+// xmpQualified returns the qualified name of the given local name and prefix.
+func xmpQualified(prefix, local string) string {
+	if prefix == "" {
+		return local
+	}
+	return prefix + ":" + local
+}
+
+// WriteXMPSidecar writes the tags and rating to the given sidecar as dc:subject and xmp:Rating. If the sidecar exists, only those properties are replaced so that anything else written by other tools is kept. Properties are found by their namespace rather than their prefix, and the prefixes written are those in scope at the rdf:Description that is edited.
+func WriteXMPSidecar(path string, s XMPState) error {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		b = []byte("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n <rdf:RDF xmlns:rdf=\"" + xmpNamespaceRDF + "\">\n  <rdf:Description rdf:about=\"\"/>\n </rdf:RDF>\n</x:xmpmeta>\n")
+	} else if err != nil {
+		return err
+	}
+	doc, err := editXMP(b, s)
+	if err != nil {
+		return &XMPSidecarError{path, err.Error()}
+	}
+	return os.WriteFile(path, doc, 0644)
+}
+
+// editXMP returns the given sidecar with the ratings and subjects of every rdf:Description removed and the given state written to the first.
+func editXMP(b []byte, s XMPState) ([]byte, error) {
+	type element struct {
+		name     xml.Name
+		start    int
+		remove   bool
+		bindings map[string]string
+	}
+	var stack []element
+	var descriptions []xmpDescriptionTag
+	var edits []xmpEdit
+	d := xml.NewDecoder(bytes.NewReader(b))
+	for {
+		start := int(d.InputOffset())
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			bindings := make(map[string]string)
+			if len(stack) > 0 {
+				for p, space := range stack[len(stack)-1].bindings {
+					bindings[p] = space
+				}
+			}
+			for _, a := range t.Attr {
+				if a.Name.Space == "xmlns" {
+					bindings[a.Name.Local] = a.Value
+				} else if a.Name.Space == "" && a.Name.Local == "xmlns" {
+					bindings[""] = a.Value
+				}
+			}
+			e := element{
+				name:     t.Name,
+				start:    start,
+				bindings: bindings,
+			}
+			// Only the direct children of an rdf:Description are its properties.
+			if n := len(stack); n > 0 && isXMPDescription(stack[n-1].name) {
+				e.remove = (t.Name.Space == xmpNamespaceXMP && t.Name.Local == "Rating") || (t.Name.Space == xmpNamespaceDC && t.Name.Local == "subject")
+			}
+			if isXMPDescription(t.Name) {
+				descriptions = append(descriptions, xmpDescriptionTag{
+					start:    start,
+					end:      int(d.InputOffset()),
+					bindings: bindings,
+				})
+			}
+			stack = append(stack, e)
+		case xml.EndElement:
+			e := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if e.remove {
+				// Take the indentation before the property along with it.
+				for e.start > 0 && strings.IndexByte(" \t\r\n", b[e.start-1]) != -1 {
+					e.start--
+				}
+				edits = append(edits, xmpEdit{e.start, int(d.InputOffset()), ""})
+			}
+		}
+	}
+	if len(descriptions) == 0 {
+		return nil, errors.New("missing rdf:Description")
+	}
+
+	for i, desc := range descriptions {
+		tag := string(b[desc.start:desc.end])
+		tag = xmpRatingAttribute.ReplaceAllStringFunc(tag, func(attr string) string {
+			if desc.bindings[xmpRatingAttribute.FindStringSubmatch(attr)[1]] == xmpNamespaceXMP {
+				return ""
+			}
+			return attr
+		})
+		if i > 0 {
+			edits = append(edits, xmpEdit{desc.start, desc.end, tag})
+			continue
+		}
+
+		selfClosing := strings.HasSuffix(tag, "/>")
+		tag = strings.TrimSuffix(strings.TrimSuffix(tag, ">"), "/")
+		tag = strings.TrimRight(tag, " \t\r\n")
+		rdf, _ := desc.prefix(xmpNamespaceRDF)
+		dc, ok := desc.prefix(xmpNamespaceDC)
+		if !ok {
+			dc = desc.unusedPrefix("dc")
+			tag += "\n    xmlns:" + dc + "=\"" + xmpNamespaceDC + "\""
+		}
+		xmp, ok := desc.prefix(xmpNamespaceXMP)
+		if !ok {
+			xmp = desc.unusedPrefix("xmp")
+			tag += "\n    xmlns:" + xmp + "=\"" + xmpNamespaceXMP + "\""
+		}
+		tag += "\n   " + xmp + ":Rating=\"" + strconv.FormatFloat(s.Rating, 'f', -1, 64) + "\">"
+
+		if len(s.Tags) > 0 {
+			tag += "\n   <" + dc + ":subject>\n    <" + xmpQualified(rdf, "Bag") + ">"
+			for _, t := range s.Tags {
+				tag += "\n     <" + xmpQualified(rdf, "li") + ">" + html.EscapeString(t) + "</" + xmpQualified(rdf, "li") + ">"
+			}
+			tag += "\n    </" + xmpQualified(rdf, "Bag") + ">\n   </" + dc + ":subject>"
+		}
+		if selfClosing {
+			tag += "\n  </" + xmpQualified(rdf, "Description") + ">"
+		}
+		edits = append(edits, xmpEdit{desc.start, desc.end, tag})
+	}
+
+	// The edits never overlap, so they are applied from last to first to keep the earlier offsets valid.
+	sort.Slice(edits, func(i, j int) bool {
+		return edits[i].start > edits[j].start
+	})
+	doc := append([]byte(nil), b...)
+	for _, e := range edits {
+		doc = append(doc[:e.start], append([]byte(e.text), doc[e.end:]...)...)
+	}
+	return doc, nil
+}
+
+// isXMPDescription returns if the given name is rdf:Description.
+func isXMPDescription(name xml.Name) bool {
+	return name.Space == xmpNamespaceRDF && name.Local == "Description"
+}
+
+// SetDirectoryXMPSidecars sets how the given directory's entries are synced with their XMP sidecars as an undoable action.
+func (p *Project) SetDirectoryXMPSidecars(u uuid.UUID, mode string) error {
+	if mode != "" && mode != XMPRead && mode != XMPWrite && mode != XMPBoth {
+		return &XMPModeError{mode: mode}
+	}
+	var current string
+	if err := p.readDirectory(u, func(d *Directory) { current = d.XMPSidecars }); err != nil {
+		return err
+	}
+	if current == mode {
+		return nil
+	}
+	p.apply(&SetDirectoryXMPSidecarsAction{
+		UUID: u,
+		Mode: mode,
+	})
+	return nil
+}
+
+// xmpCandidate is a copy of an entry's tags, rating, and last synced state, so that its sidecar can be read and written without holding the lock.
+type xmpCandidate struct {
+	path    string
+	file    string // file is the full path of the entry's file.
+	project XMPState
+	base    XMPState
+	synced  *XMPState // synced is the state both sides hold once the sidecar was handled, if they agree.
+	read    bool      // read is if the entry is to be updated from its sidecar, whose state is synced.
+}
+
+// SyncXMPSidecars syncs the tags and ratings of the given directory's entries with their XMP sidecars according to the directory's mode. Whichever side changed since the last sync is copied to the other. If both changed, the entry is reported as a conflict and neither is touched. Entries updated from sidecars are applied as a single undoable action. Sidecars are read and written without holding the lock, and entries that changed in the meantime are left for the next sync.
+func (p *Project) SyncXMPSidecars(u uuid.UUID) (XMPSyncReport, error) {
+	report := XMPSyncReport{
+		Conflicts: make([]XMPConflict, 0),
+		Failures:  make([]XMPFailure, 0),
+	}
+	var mode string
+	var candidates []*xmpCandidate
+	err := p.readDirectory(u, func(d *Directory) {
+		mode = d.XMPSidecars
+		for _, e := range d.Entries {
+			if e.Missing || strings.EqualFold(filepath.Ext(e.Path), ".xmp") {
+				continue
+			}
+			c := &xmpCandidate{
+				path:    e.Path,
+				file:    filepath.Join(d.Path, e.Path),
+				project: *(&XMPState{Tags: e.Tags, Rating: e.Rating}).Clone(),
+			}
+			// An entry that was never synced is compared against nothing, so that an empty side is never considered changed.
+			if e.XMP != nil {
+				c.base = *e.XMP.Clone()
+			}
+			candidates = append(candidates, c)
+		}
+	})
+	if err != nil {
+		return report, err
+	}
+	if mode != XMPRead && mode != XMPWrite && mode != XMPBoth {
+		var dir string
+		p.readDirectory(u, func(d *Directory) { dir = d.Path })
+		return report, &XMPModeError{dir: dir, mode: mode}
+	}
+
+	for _, c := range candidates {
+		syncXMPSidecar(u, c, mode, &report)
+	}
+
+	var actions []do.Action[*Project]
+	p.mutex.Lock()
+	if d, err := p.GetDirectoryByUUID(u); err == nil {
+		for _, c := range candidates {
+			if c.synced == nil {
+				continue
+			}
+			e := d.Entry(c.path)
+			if e == nil || !(XMPState{Tags: e.Tags, Rating: e.Rating}).Equal(c.project) {
+				continue
+			}
+			e.XMP = c.synced.Clone()
+			if c.read {
+				entry := e.Clone()
+				entry.Tags = p.TagRegistry.Apply(c.synced.Tags)
+				entry.Rating = c.synced.Rating
+				actions = append(actions, &UpdateEntryAction{
+					UUID:  d.UUID,
+					path:  e.Path,
+					Entry: entry,
+				})
+			}
+		}
+	}
+	p.mutex.Unlock()
+	if len(actions) > 0 {
+		p.apply(&GroupedAction{
+			Actions: actions,
+		})
+	}
+	return report, nil
+}
+
+// syncXMPSidecar syncs the sidecar of the given candidate of the given directory according to mode, recording the outcome in the candidate and report.
+func syncXMPSidecar(u uuid.UUID, c *xmpCandidate, mode string, report *XMPSyncReport) {
+	canRead := mode == XMPRead || mode == XMPBoth
+	canWrite := mode == XMPWrite || mode == XMPBoth
+	fail := func(err error) {
+		report.Failures = append(report.Failures, XMPFailure{
+			Path:  c.path,
+			Error: err.Error(),
+		})
+	}
+
+	sidecar, exists := XMPSidecarPath(c.file)
+	if !exists {
+		if canWrite && (len(c.project.Tags) > 0 || c.project.Rating != 0) {
+			if err := WriteXMPSidecar(sidecar, c.project); err != nil {
+				fail(err)
+				return
+			}
+			c.synced = c.project.Clone()
+			report.Written++
+		}
+		return
+	}
+	side, err := ReadXMPSidecar(sidecar)
+	if err != nil {
+		fail(err)
+		return
+	}
+	if c.project.Equal(side) {
+		c.synced = c.project.Clone()
+		return
+	}
+
+	projectChanged := !c.project.Equal(c.base)
+	sideChanged := !side.Equal(c.base)
+	switch {
+	case sideChanged && !projectChanged && canRead:
+		c.synced = side.Clone()
+		c.read = true
+		report.Read++
+	case projectChanged && !sideChanged && canWrite:
+		if err := WriteXMPSidecar(sidecar, c.project); err != nil {
+			fail(err)
+			return
+		}
+		c.synced = c.project.Clone()
+		report.Written++
+	case projectChanged && !sideChanged:
+		// Read only, so the project's changes stay in the project.
+	default:
+		report.Conflicts = append(report.Conflicts, XMPConflict{
+			Directory:   u,
+			Path:        c.path,
+			SidecarPath: sidecar,
+			Project:     *c.project.Clone(),
+			Sidecar:     side,
+		})
+	}
+}
+
+// ResolveXMPConflict resolves a conflict between an entry and its XMP sidecar by copying one side to the other. If useSidecar is true, the entry is updated from its sidecar as an undoable action, with the tag registry applied to its tags, otherwise the sidecar is overwritten by the entry. The sidecar is read or written without holding the lock.
+func (p *Project) ResolveXMPConflict(u uuid.UUID, path string, useSidecar bool) error {
+	dirPath, e, err := p.entryCopy(u, path)
+	if err != nil {
+		return err
+	}
+	project := XMPState{Tags: e.Tags, Rating: e.Rating}
+	sidecar, exists := XMPSidecarPath(filepath.Join(dirPath, e.Path))
+	synced := project
+	if useSidecar {
+		if !exists {
+			return os.ErrNotExist
+		}
+		if synced, err = ReadXMPSidecar(sidecar); err != nil {
+			return err
+		}
+	} else if err := WriteXMPSidecar(sidecar, project); err != nil {
+		return err
+	}
+
+	var actions []do.Action[*Project]
+	p.mutex.Lock()
+	if d, err := p.GetDirectoryByUUID(u); err == nil {
+		if e := d.Entry(path); e != nil && (XMPState{Tags: e.Tags, Rating: e.Rating}).Equal(project) {
+			e.XMP = synced.Clone()
+			if useSidecar {
+				entry := e.Clone()
+				entry.Tags = p.TagRegistry.Apply(synced.Tags)
+				entry.Rating = synced.Rating
+				actions = append(actions, &UpdateEntryAction{
+					UUID:  u,
+					path:  path,
+					Entry: entry,
+				})
+			}
+		}
+	}
+	p.mutex.Unlock()
+	if len(actions) > 0 {
+		p.apply(actions[0])
+	}
+	return nil
+}
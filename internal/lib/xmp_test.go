@@ -0,0 +1,91 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteXMPSidecar(t *testing.T) {
+	const (
+		head = `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="` + xmpNamespaceRDF + `"`
+		tail = `</rdf:RDF></x:xmpmeta>`
+	)
+	tests := []struct {
+		name    string
+		sidecar string // sidecar is the existing sidecar, if any.
+		keep    []string
+		drop    []string
+	}{
+		{
+			name: "new",
+		},
+		{
+			name:    "conventional prefixes",
+			sidecar: head + `><rdf:Description rdf:about="" xmlns:dc="` + xmpNamespaceDC + `" xmlns:xmp="` + xmpNamespaceXMP + `" xmp:Rating="2"><dc:subject><rdf:Bag><rdf:li>old</rdf:li></rdf:Bag></dc:subject></rdf:Description>` + tail,
+			drop:    []string{"old", `"2"`},
+		},
+		{
+			name:    "other prefixes",
+			sidecar: head + `><rdf:Description rdf:about="" xmlns:d="` + xmpNamespaceDC + `" xmlns:xap="` + xmpNamespaceXMP + `" xap:Rating="2"><d:subject><rdf:Bag><rdf:li>old</rdf:li></rdf:Bag></d:subject><d:title>kept</d:title></rdf:Description>` + tail,
+			keep:    []string{"kept", "<d:subject>", "xap:Rating"},
+			drop:    []string{"old", `"2"`, "xmlns:dc=", "xmlns:xmp="},
+		},
+		{
+			name:    "properties on a sibling",
+			sidecar: head + `><rdf:Description rdf:about=""/><rdf:Description rdf:about="" xmlns:dc="` + xmpNamespaceDC + `" xmlns:xmp="` + xmpNamespaceXMP + `"><dc:subject><rdf:Bag><rdf:li>old</rdf:li></rdf:Bag></dc:subject><xmp:Rating>2</xmp:Rating><dc:title>kept</dc:title></rdf:Description>` + tail,
+			keep:    []string{"kept"},
+			drop:    []string{"old", ">2<"},
+		},
+		{
+			name:    "conventional prefix taken",
+			sidecar: head + ` xmlns:dc="urn:other"><rdf:Description rdf:about="" dc:note="kept"/>` + tail,
+			keep:    []string{`dc:note="kept"`, "xmlns:dc1="},
+		},
+		{
+			name:    "default namespace",
+			sidecar: `<x:xmpmeta xmlns:x="adobe:ns:meta/"><RDF xmlns="` + xmpNamespaceRDF + `"><Description about=""/></RDF></x:xmpmeta>`,
+			keep:    []string{"<Bag>", "</Description>"},
+		},
+	}
+	want := XMPState{
+		Tags:   []string{"a&b", "c"},
+		Rating: 4,
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "image.png.xmp")
+			if tt.sidecar != "" {
+				if err := os.WriteFile(path, []byte(tt.sidecar), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := WriteXMPSidecar(path, want); err != nil {
+				t.Fatalf("WriteXMPSidecar() error = %v", err)
+			}
+			got, err := ReadXMPSidecar(path)
+			if err != nil {
+				t.Fatalf("ReadXMPSidecar() error = %v", err)
+			}
+			if !got.Equal(want) {
+				t.Errorf("ReadXMPSidecar() = %v, want %v", got, want)
+			}
+			b, _ := os.ReadFile(path)
+			doc := string(b)
+			if n := strings.Count(doc, "Rating"); n != 1 {
+				t.Errorf("sidecar has %d ratings, want 1:\n%s", n, doc)
+			}
+			for _, s := range tt.keep {
+				if !strings.Contains(doc, s) {
+					t.Errorf("sidecar is missing %q:\n%s", s, doc)
+				}
+			}
+			for _, s := range tt.drop {
+				if strings.Contains(doc, s) {
+					t.Errorf("sidecar still has %q:\n%s", s, doc)
+				}
+			}
+		})
+	}
+}
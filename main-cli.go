@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"treesource/internal/lib"
+)
+
+// runCommand runs a non-interactive subcommand, writing its JSON result to stdout, and returns the exit code.
+func runCommand(args []string) int {
+	// The lib package logs its actions and events, which would only be noise around the JSON output.
+	log.SetOutput(io.Discard)
+
+	a := lib.NewApp()
+	if err := a.RunCommand(args, os.Stdout); err != nil {
+		if _, ok := err.(*lib.UsageError); ok {
+			fmt.Fprintf(os.Stderr, "commands:\n  %s\n", strings.Join(lib.CommandUsage(), "\n  "))
+		}
+		return 1
+	}
+	return 0
+}
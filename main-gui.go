@@ -5,6 +5,7 @@ package main
 import (
 	"embed"
 	"fmt"
+	"os"
 	"treesource/internal/lib"
 	xdgicons "treesource/internal/xdg-icons"
 
@@ -20,6 +21,10 @@ var assets embed.FS
 var app *WApp
 
 func main() {
+	if len(os.Args) > 1 && lib.IsCommand(os.Args[1]) {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
 	// Create an instance of the app structure
 	app = &WApp{
 		App:     *lib.NewApp(),
@@ -40,6 +45,10 @@ func main() {
 		panic(err)
 	}
 
+	app.Thumbnailer.On(lib.EventThumbnail, func(e lib.Event) {
+		runtime.EventsEmit(app.Context(), lib.EventThumbnail, e)
+	})
+
 	// Create application with options
 	err = wails.Run(&options.App{
 		Title:  "treesource",
@@ -94,10 +103,13 @@ func (w *WApp) Ready() {
 	if w.Project == nil {
 		return
 	}
+	w.Project.RLock()
 	runtime.EventsEmit(w.Context(), "project-load", w.Project)
+	w.Project.RUnlock()
 	w.RefreshTitle()
 	// Also send the actual directory contents.
 
+	w.Project.RLock()
 	for _, d := range w.Project.Directories {
 		w.Project.Emit(lib.EventDirectory, lib.DirectoryAddEvent{
 			UUID: d.UUID,
@@ -107,6 +119,7 @@ func (w *WApp) Ready() {
 	for _, d := range w.Project.Directories {
 		d.EmitAllEntries()
 	}
+	w.Project.RUnlock()
 
 	// Send session state.
 	w.Session.Refresh()
@@ -129,6 +142,9 @@ func (w *WApp) SetupSession() error {
 	app.Session.On(lib.EventViewTagsRemove, func(e lib.Event) {
 		runtime.EventsEmit(app.Context(), lib.EventViewTagsRemove, e)
 	})
+	app.Session.On(lib.EventViewTagsUpdate, func(e lib.Event) {
+		runtime.EventsEmit(app.Context(), lib.EventViewTagsUpdate, e)
+	})
 	app.Session.On(lib.EventViewSelect, func(e lib.Event) {
 		runtime.EventsEmit(app.Context(), lib.EventViewSelect, e)
 	})
@@ -186,9 +202,18 @@ func (w *WApp) InitProject() error {
 	w.Project.On("directory-sync", func(e lib.Event) {
 		runtime.EventsEmit(w.Context(), lib.EventDirectorySync, e)
 	})
+	w.Project.On(lib.EventDirectorySyncProgress, func(e lib.Event) {
+		runtime.EventsEmit(w.Context(), lib.EventDirectorySyncProgress, e)
+	})
 	w.Project.On("directory-synced", func(e lib.Event) {
 		runtime.EventsEmit(w.Context(), lib.EventDirectorySynced, e)
 	})
+	w.Project.On(lib.EventDirectoryRelocate, func(e lib.Event) {
+		runtime.EventsEmit(w.Context(), lib.EventDirectoryRelocate, e)
+	})
+	w.Project.On(lib.EventDirectoryWatch, func(e lib.Event) {
+		runtime.EventsEmit(w.Context(), lib.EventDirectoryWatch, e)
+	})
 	w.Project.On("directory-entry", func(e lib.Event) {
 		runtime.EventsEmit(w.Context(), lib.EventDirectoryEntry, e)
 	})
@@ -204,10 +229,29 @@ func (w *WApp) InitProject() error {
 	w.Project.On("directory-entry-missing", func(e lib.Event) {
 		runtime.EventsEmit(w.Context(), lib.EventDirectoryEntryMissing, e)
 	})
+	w.Project.On("directory-entry-move", func(e lib.Event) {
+		runtime.EventsEmit(w.Context(), lib.EventDirectoryEntryMove, e)
+	})
 	w.Project.On("directory-entry-found", func(e lib.Event) {
 		runtime.EventsEmit(w.Context(), lib.EventDirectoryEntryFound, e)
 	})
 
+	w.Project.On(lib.EventTagRegistryUpdate, func(e lib.Event) {
+		runtime.EventsEmit(w.Context(), lib.EventTagRegistryUpdate, e)
+	})
+	w.Project.On(lib.EventDirectoryEntryChange, func(e lib.Event) {
+		runtime.EventsEmit(w.Context(), lib.EventDirectoryEntryChange, e)
+	})
+	w.Project.On(lib.EventDuplicatesProgress, func(e lib.Event) {
+		runtime.EventsEmit(w.Context(), lib.EventDuplicatesProgress, e)
+	})
+	w.Project.On(lib.EventExportProgress, func(e lib.Event) {
+		runtime.EventsEmit(w.Context(), lib.EventExportProgress, e)
+	})
+	w.Project.On(lib.EventExportError, func(e lib.Event) {
+		runtime.EventsEmit(w.Context(), lib.EventExportError, e)
+	})
+
 	w.App.InitProject()
 
 	return nil
@@ -229,7 +273,10 @@ func (w *WApp) AddProjectDirectory(dir string, ignoreDot bool) error {
 }
 
 func (w *WApp) GetProject() *lib.Project {
-	return w.Project
+	if w.Project == nil {
+		return nil
+	}
+	return w.Project.Snapshot()
 }
 
 func (w *WApp) RefreshTitle() {
@@ -260,6 +307,14 @@ func (w *WApp) AddTagsView(tags []string) error {
 	return w.Session.AddTagsView(tags)
 }
 
+func (w *WApp) AddTagsQueryView(query string) error {
+	return w.Session.AddTagsQueryView(query)
+}
+
+func (w *WApp) SetTagsViewQuery(u uuid.UUID, query string) error {
+	return w.Session.SetTagsViewQuery(u, query)
+}
+
 func (w *WApp) RemoveTagsView(u uuid.UUID) error {
 	return w.Session.RemoveTagsView(u)
 }
@@ -2,8 +2,877 @@
 
 package main
 
-import "fmt"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"treesource/internal/lib"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/google/uuid"
+	"github.com/rivo/tview"
+)
+
+var app *TApp
 
 func main() {
-	fmt.Println("TODO")
+	if len(os.Args) > 1 && lib.IsCommand(os.Args[1]) {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
+	// The lib package logs its actions and events to stderr, which would trample the screen.
+	log.SetOutput(io.Discard)
+
+	app = &TApp{
+		App: *lib.NewApp(),
+	}
+
+	if err := lib.EnsureSession("default"); err != nil {
+		panic(err)
+	}
+
+	session, err := lib.LoadSession("default")
+	if err != nil {
+		panic(err)
+	}
+	app.Session = session
+
+	app.Setup()
+
+	if app.Session.Project != "" {
+		if err := app.LoadProjectFile(app.Session.Project, true); err != nil {
+			app.Status(err.Error())
+		}
+	}
+	app.SelectView(app.Session.SelectedView)
+
+	if err := app.tui.Run(); err != nil {
+		panic(err)
+	}
+
+	// Flush the session immediately rather than waiting on a pending save.
+	if err := app.Session.Save(); err != nil {
+		panic(err)
+	}
+}
+
+// entryRow is the reference attached to each row of the entries table.
+type entryRow struct {
+	dir    uuid.UUID
+	folder string
+	entry  *lib.DirectoryEntry // entry is a copy taken while holding the project's lock, so that it can be drawn without it.
+}
+
+// viewRef is the reference attached to view nodes in the sidebar.
+type viewRef uuid.UUID
+
+// TApp wraps lib.App with a tview-based terminal interface.
+type TApp struct {
+	lib.App
+	tui     *tview.Application
+	pages   *tview.Pages
+	sidebar *tview.TreeView
+	entries *tview.Table
+	info    *tview.TextView
+	status  *tview.TextView
+	message string
+	view    uuid.UUID
+	dirty   bool
+	// queue guards queued and queuedMessage, which hold a refresh requested from outside of the interface's goroutine until it runs.
+	queue         sync.Mutex
+	queued        bool
+	queuedMessage string
+}
+
+// Setup creates the interface and hooks up session events.
+func (t *TApp) Setup() {
+	t.tui = tview.NewApplication()
+
+	t.sidebar = tview.NewTreeView()
+	t.sidebar.SetBorder(true).SetTitle(" Project ")
+	t.sidebar.SetSelectedFunc(t.sidebarSelected)
+	t.sidebar.SetInputCapture(t.sidebarInput)
+
+	t.entries = tview.NewTable().SetSelectable(true, false)
+	t.entries.SetBorder(true).SetTitle(" Entries ")
+	t.entries.SetSelectedFunc(func(row, column int) {
+		t.entrySelected(row)
+	})
+	t.entries.SetSelectionChangedFunc(func(row, column int) {
+		t.entryFocused(row)
+	})
+	t.entries.SetInputCapture(t.entriesInput)
+
+	t.info = tview.NewTextView().SetDynamicColors(true)
+	t.info.SetBorder(true).SetTitle(" Entry ")
+
+	t.status = tview.NewTextView().SetDynamicColors(true)
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(tview.NewFlex().
+			AddItem(t.sidebar, 0, 1, true).
+			AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+				AddItem(t.entries, 0, 1, false).
+				AddItem(t.info, 5, 0, false), 0, 3, false), 0, 1, true).
+		AddItem(t.status, 1, 0, false)
+
+	t.pages = tview.NewPages().AddPage("main", layout, true, true)
+
+	t.tui.SetRoot(t.pages, true)
+	t.tui.SetInputCapture(t.globalInput)
+	t.tui.SetBeforeDrawFunc(func(screen tcell.Screen) bool {
+		if t.dirty {
+			t.dirty = false
+			t.refresh()
+		}
+		return false
+	})
+
+	markDirty := func(e lib.Event) {
+		t.dirty = true
+	}
+	t.Session.On(lib.EventViewDirectoryAdd, markDirty)
+	t.Session.On(lib.EventViewDirectoryRemove, markDirty)
+	t.Session.On(lib.EventViewTagsAdd, markDirty)
+	t.Session.On(lib.EventViewTagsRemove, markDirty)
+	t.Session.On(lib.EventViewTagsUpdate, markDirty)
+	t.Session.On(lib.EventViewDirectoryNavigate, markDirty)
+	t.Session.On(lib.EventViewSelect, func(e lib.Event) {
+		if ev, ok := e.(*lib.ViewSelectEvent); ok {
+			t.view = ev.UUID
+		}
+		t.dirty = true
+	})
+
+	t.dirty = true
+}
+
+// queueRefresh refreshes the interface, along with showing msg if it is not empty, from the interface's goroutine. Project events are emitted from watchers and syncs, so their handlers must use this rather than touching the interface. Requests are coalesced so that a sync emitting many events never fills tview's update queue.
+func (t *TApp) queueRefresh(msg string) {
+	t.queue.Lock()
+	if msg != "" {
+		t.queuedMessage = msg
+	}
+	if t.queued {
+		t.queue.Unlock()
+		return
+	}
+	t.queued = true
+	t.queue.Unlock()
+
+	t.tui.QueueUpdateDraw(func() {
+		t.queue.Lock()
+		if t.queuedMessage != "" {
+			t.message = t.queuedMessage
+			t.queuedMessage = ""
+		}
+		t.queued = false
+		t.queue.Unlock()
+		t.dirty = true
+	})
+}
+
+func (t *TApp) NewProject(name string, dir string, ignoreDot bool) error {
+	err := t.App.NewProject(name, dir, ignoreDot)
+	if err == nil {
+		t.InitProject()
+		t.Session.Project = t.Project.Path
+		t.Session.PendingSave()
+	}
+	t.dirty = true
+	return err
+}
+
+func (t *TApp) LoadProjectFile(name string, force bool) error {
+	err := t.App.LoadProjectFile(name, force)
+	if err == nil {
+		t.InitProject()
+		t.Session.Project = t.Project.Path
+		t.Session.PendingSave()
+	}
+	t.dirty = true
+	return err
+}
+
+// InitProject hooks the interface up to the project's events and syncs its directories for the first time in the background, as SyncAll does.
+func (t *TApp) InitProject() {
+	markDirty := func(e lib.Event) {
+		t.queueRefresh("")
+	}
+	t.Project.On(lib.EventProjectChange, markDirty)
+	t.Project.On(lib.EventDirectoryAdd, markDirty)
+	t.Project.On(lib.EventDirectoryRemove, markDirty)
+	t.Project.On(lib.EventDirectorySynced, func(e lib.Event) {
+		if ev, ok := e.(*lib.DirectorySyncedEvent); ok && ev.Error != nil {
+			t.queueRefresh(ev.Error.Error())
+			return
+		}
+		t.queueRefresh("")
+	})
+	t.Project.On(lib.EventDirectorySyncProgress, func(e lib.Event) {
+		if ev, ok := e.(*lib.DirectorySyncProgressEvent); ok {
+			t.queueRefresh(fmt.Sprintf("syncing: %d files, %d added, %d missing, x to cancel", ev.Files, ev.Added, ev.Missing))
+		}
+	})
+	t.Project.On(lib.EventDirectoryWatch, func(e lib.Event) {
+		if ev, ok := e.(lib.DirectoryWatchEvent); ok && ev.Error != nil {
+			t.queueRefresh(ev.Error.Error())
+			return
+		}
+		t.queueRefresh("")
+	})
+	t.Project.On(lib.EventDirectoryEntryAdd, markDirty)
+	t.Project.On(lib.EventDirectoryEntryRemove, markDirty)
+	t.Project.On(lib.EventDirectoryEntryUpdate, markDirty)
+	t.Project.On(lib.EventDirectoryEntryMissing, markDirty)
+	t.Project.On(lib.EventDirectoryEntryFound, markDirty)
+	t.Project.On(lib.EventDirectoryEntryMove, markDirty)
+
+	t.Status("syncing, x to cancel")
+	go func() {
+		err := t.App.InitProject()
+		if errors.Is(err, context.Canceled) {
+			t.queueRefresh("sync canceled")
+		} else if err != nil {
+			t.queueRefresh(err.Error())
+		} else {
+			t.queueRefresh("synced")
+		}
+	}()
+}
+
+func (t *TApp) CloseProjectFile(force bool) error {
+	err := t.App.CloseProjectFile(force)
+	if err == nil {
+		t.Session.Project = ""
+		t.Session.PendingSave()
+	}
+	t.dirty = true
+	return err
+}
+
+// SelectView selects the given view, falling back to the first available view if it does not exist.
+func (t *TApp) SelectView(u uuid.UUID) {
+	if _, err := t.Session.GetDirectoryView(u); err != nil {
+		if _, err := t.Session.GetTagsView(u); err != nil {
+			u = uuid.Nil
+			if len(t.Session.Views.Directories) > 0 {
+				u = t.Session.Views.Directories[0].UUID
+			} else if len(t.Session.Views.Tags) > 0 {
+				u = t.Session.Views.Tags[0].UUID
+			}
+		}
+	}
+	t.Session.SelectView(u)
+}
+
+// Status sets the status bar message. It must be called from the interface's goroutine; event handlers use queueRefresh instead.
+func (t *TApp) Status(msg string) {
+	t.message = msg
+	t.dirty = true
+}
+
+func (t *TApp) refresh() {
+	t.refreshSidebar()
+	t.refreshEntries()
+	t.refreshStatus()
+}
+
+func (t *TApp) refreshStatus() {
+	title := "no project"
+	if t.Project != nil {
+		title = t.Project.Title
+		if t.Unsaved() {
+			title = "*" + title
+		}
+	}
+	var undo, redo string
+	if t.Undoable() {
+		undo = " [green]undo"
+	}
+	if t.Redoable() {
+		redo = " [green]redo"
+	}
+	t.status.SetText(fmt.Sprintf("[::b]%s[::-]%s%s [white]%s", tview.Escape(title), undo, redo, tview.Escape(t.message)))
+}
+
+func (t *TApp) refreshSidebar() {
+	var current interface{}
+	if n := t.sidebar.GetCurrentNode(); n != nil {
+		current = n.GetReference()
+	}
+
+	root := tview.NewTreeNode("treesource").SetSelectable(false)
+	if t.Project != nil {
+		root.SetText(t.Project.Title)
+	}
+
+	dirs := tview.NewTreeNode("Directories").SetSelectable(false)
+	root.AddChild(dirs)
+	// Watching takes the project's lock itself, so the directories are read before it is called.
+	paths := make(map[uuid.UUID]string)
+	var uuids []uuid.UUID
+	if t.Project != nil {
+		t.Project.RLock()
+		for _, d := range t.Project.Directories {
+			paths[d.UUID] = d.Path
+			uuids = append(uuids, d.UUID)
+		}
+		t.Project.RUnlock()
+		for _, u := range uuids {
+			name := paths[u]
+			if t.Project.Watching(u) {
+				name += " (watching)"
+			}
+			dirs.AddChild(tview.NewTreeNode(name).SetReference(u).SetColor(tcell.ColorBlue))
+		}
+	}
+
+	views := tview.NewTreeNode("Views").SetSelectable(false)
+	root.AddChild(views)
+	for _, v := range t.Session.Views.Directories {
+		name := v.Directory.String()
+		if path, ok := paths[v.Directory]; ok {
+			name = filepath.Base(path)
+		}
+		if v.WD != "" {
+			name = filepath.Join(name, v.WD)
+		}
+		views.AddChild(t.viewNode(v.UUID, name))
+	}
+	for _, v := range t.Session.Views.Tags {
+		views.AddChild(t.viewNode(v.UUID, "? "+v.Expression()))
+	}
+
+	t.sidebar.SetRoot(root).SetCurrentNode(nil)
+	root.Walk(func(node, parent *tview.TreeNode) bool {
+		if current != nil && node.GetReference() == current {
+			t.sidebar.SetCurrentNode(node)
+			return false
+		}
+		return true
+	})
+	if t.sidebar.GetCurrentNode() == nil {
+		for _, n := range append(dirs.GetChildren(), views.GetChildren()...) {
+			t.sidebar.SetCurrentNode(n)
+			break
+		}
+	}
+}
+
+func (t *TApp) viewNode(u uuid.UUID, name string) *tview.TreeNode {
+	n := tview.NewTreeNode(name).SetReference(viewRef(u))
+	if u == t.view {
+		n.SetColor(tcell.ColorYellow)
+	}
+	return n
+}
+
+func (t *TApp) refreshEntries() {
+	row, _ := t.entries.GetSelection()
+	t.entries.Clear()
+
+	rows := t.viewRows()
+	for i, r := range rows {
+		name := tview.NewTableCell("").SetReference(r).SetExpansion(1)
+		rating := tview.NewTableCell("").SetTextColor(tcell.ColorYellow)
+		tags := tview.NewTableCell("").SetTextColor(tcell.ColorGreen).SetExpansion(2)
+		if r.entry == nil {
+			name.SetText(r.folder + string(os.PathSeparator)).SetTextColor(tcell.ColorBlue)
+		} else {
+			name.SetText(r.folder)
+			if r.entry.Missing {
+				name.SetTextColor(tcell.ColorRed)
+			}
+			rating.SetText(stars(r.entry.Rating))
+			tags.SetText(strings.Join(r.entry.Tags, " "))
+		}
+		t.entries.SetCell(i, 0, name)
+		t.entries.SetCell(i, 1, rating)
+		t.entries.SetCell(i, 2, tags)
+	}
+
+	if row >= len(rows) {
+		row = len(rows) - 1
+	}
+	if row < 0 {
+		row = 0
+	}
+	t.entries.Select(row, 0)
+	t.refreshInfo(row)
+}
+
+func (t *TApp) refreshInfo(row int) {
+	r := t.rowAt(row)
+	if r == nil || r.entry == nil {
+		t.info.SetText("")
+		return
+	}
+	var s string
+	s += fmt.Sprintf("[::b]%s[::-]", tview.Escape(r.entry.Path))
+	if r.entry.Missing {
+		s += " [red](missing)[white]"
+	}
+	s += fmt.Sprintf("\nRating: [yellow]%s[white]\nTags: [green]%s", stars(r.entry.Rating), tview.Escape(strings.Join(r.entry.Tags, ", ")))
+	t.info.SetText(s)
+}
+
+// viewRows returns the rows to show for the currently selected view.
+func (t *TApp) viewRows() (rows []*entryRow) {
+	if t.Project == nil {
+		return
+	}
+	if v, err := t.Session.GetDirectoryView(t.view); err == nil {
+		t.Project.RLock()
+		defer t.Project.RUnlock()
+		d, err := t.Project.GetDirectoryByUUID(v.Directory)
+		if err != nil {
+			return
+		}
+		t.entries.SetTitle(fmt.Sprintf(" %s ", filepath.Join(d.Path, v.WD)))
+		if v.WD != "" {
+			rows = append(rows, &entryRow{dir: d.UUID, folder: ".."})
+		}
+		folders := make(map[string]struct{})
+		var files []*entryRow
+		prefix := ""
+		if v.WD != "" {
+			prefix = v.WD + string(os.PathSeparator)
+		}
+		for _, e := range d.Entries {
+			if !strings.HasPrefix(e.Path, prefix) {
+				continue
+			}
+			rest := e.Path[len(prefix):]
+			if i := strings.IndexRune(rest, os.PathSeparator); i >= 0 {
+				folders[rest[:i]] = struct{}{}
+			} else {
+				entry := e.Clone()
+				files = append(files, &entryRow{dir: d.UUID, folder: rest, entry: &entry})
+			}
+		}
+		var names []string
+		for f := range folders {
+			names = append(names, f)
+		}
+		sort.Strings(names)
+		for _, f := range names {
+			rows = append(rows, &entryRow{dir: d.UUID, folder: f})
+		}
+		sort.Slice(files, func(i, j int) bool {
+			return files[i].folder < files[j].folder
+		})
+		rows = append(rows, files...)
+	} else if v, err := t.Session.GetTagsView(t.view); err == nil {
+		t.entries.SetTitle(fmt.Sprintf(" %s ", v.Expression()))
+		matches, err := t.QueryTagsView(v.UUID)
+		if err != nil {
+			t.message = err.Error()
+			return
+		}
+		t.Project.RLock()
+		for _, m := range matches {
+			if d, err := t.Project.GetDirectoryByUUID(m.Directory); err == nil {
+				entry := m.Entry.Clone()
+				rows = append(rows, &entryRow{dir: d.UUID, folder: filepath.Join(filepath.Base(d.Path), entry.Path), entry: &entry})
+			}
+		}
+		t.Project.RUnlock()
+	} else {
+		t.entries.SetTitle(" Entries ")
+	}
+	return
+}
+
+func (t *TApp) rowAt(row int) *entryRow {
+	c := t.entries.GetCell(row, 0)
+	if c == nil {
+		return nil
+	}
+	if r, ok := c.GetReference().(*entryRow); ok {
+		return r
+	}
+	return nil
+}
+
+func (t *TApp) currentRow() *entryRow {
+	row, _ := t.entries.GetSelection()
+	return t.rowAt(row)
+}
+
+func (t *TApp) entrySelected(row int) {
+	r := t.rowAt(row)
+	if r == nil {
+		return
+	}
+	if r.entry == nil {
+		if err := t.Session.NavigateDirectoryView(t.view, r.folder); err != nil {
+			t.Status(err.Error())
+		}
+		t.entries.Select(0, 0)
+		t.Session.PendingSave()
+		return
+	}
+	var dir string
+	t.Project.RLock()
+	d, err := t.Project.GetDirectoryByUUID(r.dir)
+	if err == nil {
+		dir = d.Path
+	}
+	t.Project.RUnlock()
+	if err == nil {
+		if err := t.OpenFile([]string{dir, r.entry.Path}); err != nil {
+			t.Status(err.Error())
+		}
+	}
+}
+
+func (t *TApp) entryFocused(row int) {
+	t.refreshInfo(row)
+	if r := t.rowAt(row); r != nil && r.entry != nil {
+		t.Session.SelectViewFiles(t.view, []string{r.entry.Path}, r.entry.Path)
+	}
+}
+
+func (t *TApp) sidebarSelected(node *tview.TreeNode) {
+	switch ref := node.GetReference().(type) {
+	case uuid.UUID:
+		// Reuse an existing view of the directory if there is one.
+		for _, v := range t.Session.Views.Directories {
+			if v.Directory == ref {
+				t.Session.SelectView(v.UUID)
+				t.tui.SetFocus(t.entries)
+				return
+			}
+		}
+		t.addDirectoryView(ref)
+	case viewRef:
+		t.Session.SelectView(uuid.UUID(ref))
+		t.tui.SetFocus(t.entries)
+	}
+}
+
+func (t *TApp) sidebarRef() interface{} {
+	if n := t.sidebar.GetCurrentNode(); n != nil {
+		return n.GetReference()
+	}
+	return nil
+}
+
+func (t *TApp) addDirectoryView(u uuid.UUID) {
+	if err := t.Session.AddDirectoryView(u); err != nil {
+		t.Status(err.Error())
+		return
+	}
+	t.Session.SelectView(t.Session.Views.Directories[len(t.Session.Views.Directories)-1].UUID)
+	t.tui.SetFocus(t.entries)
+}
+
+func (t *TApp) removeView(u uuid.UUID) {
+	if err := t.Session.RemoveDirectoryView(u); err != nil {
+		if err := t.Session.RemoveTagsView(u); err != nil {
+			t.Status(err.Error())
+			return
+		}
+	}
+	if u == t.view {
+		t.SelectView(uuid.Nil)
+	}
+}
+
+func (t *TApp) sidebarInput(event *tcell.EventKey) *tcell.EventKey {
+	switch event.Key() {
+	case tcell.KeyTab:
+		t.tui.SetFocus(t.entries)
+		return nil
+	case tcell.KeyDelete:
+		if ref, ok := t.sidebarRef().(viewRef); ok {
+			t.removeView(uuid.UUID(ref))
+		}
+		return nil
+	case tcell.KeyRune:
+		switch event.Rune() {
+		case 'v':
+			if ref, ok := t.sidebarRef().(uuid.UUID); ok {
+				t.addDirectoryView(ref)
+			}
+			return nil
+		case 'd':
+			if ref, ok := t.sidebarRef().(viewRef); ok {
+				t.removeView(uuid.UUID(ref))
+			}
+			return nil
+		case 'a':
+			if t.Project == nil {
+				t.Status("no project is loaded")
+				return nil
+			}
+			t.prompt("Add directory: ", "", func(s string) {
+				if err := t.AddProjectDirectory(s, true); err != nil {
+					t.Status(err.Error())
+				}
+			})
+			return nil
+		case 'w':
+			if ref, ok := t.sidebarRef().(uuid.UUID); ok {
+				if err := t.SetProjectDirectoryWatch(ref, !t.Project.Watching(ref)); err != nil {
+					t.Status(err.Error())
+				}
+			}
+			return nil
+		case 'D':
+			if ref, ok := t.sidebarRef().(uuid.UUID); ok {
+				t.confirm("Remove directory from project?", func() {
+					if err := t.RemoveProjectDirectory(ref); err != nil {
+						t.Status(err.Error())
+					}
+				})
+			}
+			return nil
+		}
+	}
+	return t.viewInput(event)
+}
+
+func (t *TApp) entriesInput(event *tcell.EventKey) *tcell.EventKey {
+	switch event.Key() {
+	case tcell.KeyTab:
+		t.tui.SetFocus(t.sidebar)
+		return nil
+	case tcell.KeyBackspace, tcell.KeyBackspace2, tcell.KeyLeft:
+		if _, err := t.Session.GetDirectoryView(t.view); err == nil {
+			t.Session.NavigateDirectoryView(t.view, "..")
+			t.Session.PendingSave()
+		}
+		return nil
+	case tcell.KeyRight:
+		row, _ := t.entries.GetSelection()
+		if r := t.rowAt(row); r != nil && r.entry == nil {
+			t.entrySelected(row)
+		}
+		return nil
+	case tcell.KeyRune:
+		r := t.currentRow()
+		switch event.Rune() {
+		case 'e':
+			if r != nil && r.entry != nil {
+				t.prompt("Tags: ", strings.Join(r.entry.Tags, " "), func(s string) {
+					entry := r.entry.Clone()
+					entry.Tags = strings.Fields(s)
+					t.updateEntry(r.dir, r.entry.Path, entry)
+				})
+			}
+			return nil
+		case '0', '1', '2', '3', '4', '5':
+			if r != nil && r.entry != nil {
+				entry := r.entry.Clone()
+				entry.Rating = float64(event.Rune() - '0')
+				t.updateEntry(r.dir, r.entry.Path, entry)
+			}
+			return nil
+		}
+	}
+	return t.viewInput(event)
+}
+
+// viewInput handles keys shared between the sidebar and the entries table.
+func (t *TApp) viewInput(event *tcell.EventKey) *tcell.EventKey {
+	if event.Key() != tcell.KeyRune {
+		return event
+	}
+	switch event.Rune() {
+	case 't':
+		t.prompt("Query: ", "", func(s string) {
+			if err := t.Session.AddTagsQueryView(s); err != nil {
+				t.Status(err.Error())
+				return
+			}
+			t.Session.SelectView(t.Session.Views.Tags[len(t.Session.Views.Tags)-1].UUID)
+		})
+		return nil
+	case 'f':
+		if v, err := t.Session.GetTagsView(t.view); err == nil {
+			t.prompt("Query: ", v.Expression(), func(s string) {
+				if err := t.Session.SetTagsViewQuery(v.UUID, s); err != nil {
+					t.Status(err.Error())
+				}
+			})
+		}
+		return nil
+	case 'u':
+		t.Undo()
+		t.dirty = true
+		return nil
+	case 'r':
+		t.Redo()
+		t.dirty = true
+		return nil
+	case 's':
+		t.save()
+		return nil
+	case 'S':
+		if t.Project != nil {
+			t.SyncAll()
+		}
+		return nil
+	case 'x':
+		t.CancelSync()
+		return nil
+	case 'q':
+		t.quit()
+		return nil
+	case '?':
+		t.Status("tab: switch pane  enter: open  e: edit tags  0-5: rate  t/f: add/edit query view  v/d: add/remove view  a/D: add/remove directory  w: toggle watch  u/r: undo/redo  s: save  S/x: sync/cancel sync  ^o/^n: open/new project  q: quit")
+		return nil
+	}
+	return event
+}
+
+func (t *TApp) globalInput(event *tcell.EventKey) *tcell.EventKey {
+	if name, _ := t.pages.GetFrontPage(); name != "main" {
+		return event
+	}
+	switch event.Key() {
+	case tcell.KeyCtrlZ:
+		t.Undo()
+		t.dirty = true
+		return nil
+	case tcell.KeyCtrlY:
+		t.Redo()
+		t.dirty = true
+		return nil
+	case tcell.KeyCtrlS:
+		t.save()
+		return nil
+	case tcell.KeyCtrlO:
+		t.prompt("Open project: ", t.Session.Project, func(s string) {
+			t.guardUnsaved(func(force bool) {
+				if err := t.LoadProjectFile(s, force); err != nil {
+					t.Status(err.Error())
+				}
+			})
+		})
+		return nil
+	case tcell.KeyCtrlN:
+		t.prompt("New project file: ", "", func(name string) {
+			t.prompt("Initial directory: ", "", func(dir string) {
+				t.guardUnsaved(func(force bool) {
+					if force {
+						t.CloseProjectFile(true)
+					}
+					if err := t.NewProject(name, dir, true); err != nil {
+						t.Status(err.Error())
+					}
+				})
+			})
+		})
+		return nil
+	case tcell.KeyCtrlC, tcell.KeyCtrlQ:
+		t.quit()
+		return nil
+	}
+	return event
+}
+
+// SyncAll synchronizes every directory in the project in the background, so that the interface stays responsive and the sync can be canceled.
+func (t *TApp) SyncAll() {
+	t.Status("syncing, x to cancel")
+	go func() {
+		err := t.SyncProjectDirectories(nil)
+		if errors.Is(err, context.Canceled) {
+			t.queueRefresh("sync canceled")
+		} else if err != nil {
+			t.queueRefresh(err.Error())
+		} else {
+			t.queueRefresh("synced")
+		}
+	}()
+}
+
+func (t *TApp) updateEntry(u uuid.UUID, path string, entry lib.DirectoryEntry) {
+	if err := t.UpdateProjectDirectoryEntry(u, path, entry); err != nil {
+		t.Status(err.Error())
+	}
+	t.dirty = true
+}
+
+func (t *TApp) save() {
+	if err := t.SaveProject(false); err != nil {
+		t.Status(err.Error())
+		return
+	}
+	t.Status("saved")
+}
+
+func (t *TApp) quit() {
+	t.guardUnsaved(func(force bool) {
+		t.tui.Stop()
+	})
+}
+
+// guardUnsaved calls cb immediately if the project is saved, otherwise it asks for confirmation first.
+func (t *TApp) guardUnsaved(cb func(force bool)) {
+	if !t.Unsaved() {
+		cb(false)
+		return
+	}
+	t.confirm("The project has unsaved changes. Discard them?", func() {
+		cb(true)
+	})
+}
+
+func (t *TApp) prompt(label, text string, cb func(string)) {
+	focus := t.tui.GetFocus()
+	input := tview.NewInputField().SetLabel(label).SetText(text)
+	input.SetBorder(true)
+	input.SetDoneFunc(func(key tcell.Key) {
+		t.pages.RemovePage("prompt")
+		t.tui.SetFocus(focus)
+		if key == tcell.KeyEnter {
+			cb(input.GetText())
+		}
+	})
+	t.pages.AddPage("prompt", centered(input, 60, 3), true, true)
+	t.tui.SetFocus(input)
+}
+
+func (t *TApp) confirm(text string, cb func()) {
+	focus := t.tui.GetFocus()
+	modal := tview.NewModal().SetText(text).AddButtons([]string{"Yes", "No"})
+	modal.SetDoneFunc(func(index int, label string) {
+		t.pages.RemovePage("confirm")
+		t.tui.SetFocus(focus)
+		if label == "Yes" {
+			cb()
+		}
+	})
+	t.pages.AddPage("confirm", modal, true, true)
+	t.tui.SetFocus(modal)
+}
+
+func centered(p tview.Primitive, width, height int) tview.Primitive {
+	return tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(p, height, 1, true).
+			AddItem(nil, 0, 1, false), width, 1, true).
+		AddItem(nil, 0, 1, false)
+}
+
+func stars(rating float64) string {
+	n := int(rating)
+	if n < 0 {
+		n = 0
+	} else if n > 5 {
+		n = 5
+	}
+	return strings.Repeat("★", n) + strings.Repeat("☆", 5-n)
 }